@@ -3,13 +3,14 @@ package authentication
 import (
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
-	"log"
 	"net/http"
 	"os"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/scaleway/functions-runtime/logging"
 )
 
 // ApplicationClaim represents the claims related to an application
@@ -25,6 +26,22 @@ type Claims struct {
 	jwt.StandardClaims
 }
 
+// Map - claims as a JSON object, as given to handlers in the authorizer of HTTP events
+func (c *Claims) Map() map[string]interface{} {
+	if c == nil {
+		return nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
 var (
 	errorInvalidClaims      = errors.New("invalid claims")
 	errorInvalidPublicKey   = errors.New("invalid public key")
@@ -65,7 +82,7 @@ func initEnv() {
 		parsedKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
 		if err != nil {
 			// Print additional error
-			log.Print(err.Error())
+			logging.Errorf("%v", err)
 			return
 		}
 		publicKey = parsedKey
@@ -81,8 +98,15 @@ func initEnv() {
 // - 6: Both FunctionID and NamespaceID are injected via environment variables by Scaleway
 // ---  so we have to check the authenticity of the incoming token by comparing the claims
 func Authenticate(w http.ResponseWriter, r *http.Request) error {
+	_, err := AuthenticateClaims(w, r)
+	return err
+}
+
+// AuthenticateClaims - authenticate the incoming request as Authenticate does, and return the claims of its
+// validated token, nil for public functions
+func AuthenticateClaims(w http.ResponseWriter, r *http.Request) (*Claims, error) {
 	if isPublicFunction {
-		return nil
+		return nil, nil
 	}
 
 	// Check that request holds an authentication token
@@ -92,12 +116,12 @@ func Authenticate(w http.ResponseWriter, r *http.Request) error {
 	}
 	if requestToken == "" {
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-		return errorEmptyRequestToken
+		return nil, errorEmptyRequestToken
 	}
 
 	if publicKey == nil {
 		http.Error(w, "function runtime not setup correctly", http.StatusInternalServerError)
-		return errorInvalidPublicKey
+		return nil, errorInvalidPublicKey
 	}
 
 	// Parse JWT and retrieve claims
@@ -107,31 +131,51 @@ func Authenticate(w http.ResponseWriter, r *http.Request) error {
 	})
 	if err != nil {
 		http.Error(w, "authorization token not valid", http.StatusUnauthorized)
-		return err
+		return nil, err
 	}
 
 	if len(claims.ApplicationsClaims) == 0 {
 		http.Error(w, "authorization token not valid", http.StatusUnauthorized)
-		return errorInvalidClaims
+		return nil, errorInvalidClaims
 	} else if len(claims.ApplicationsClaims) > 1 {
-		log.Println("token with more claims than expected - please upgrade your runtime")
+		logging.Warnf("token with more claims than expected - please upgrade your runtime")
 		http.Error(w, "authorization token not valid", http.StatusUnauthorized)
-		return errorInvalidClaims
+		return nil, errorInvalidClaims
 	}
 	applicationClaims := claims.ApplicationsClaims[0]
 
 	if applicationID == "" {
 		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
-		return errorInvalidApplication
+		return nil, errorInvalidApplication
 	} else if namespaceID == "" {
 		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
-		return errorInvalidNamespace
+		return nil, errorInvalidNamespace
 	}
 
 	// Check that the token's claims match with the injected Application or Namespace ID (depending on the scope of the token)
 	if applicationClaims.NamespaceID != namespaceID && applicationClaims.ApplicationID != applicationID {
 		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
-		return errorInvalidClaims
+		return nil, errorInvalidClaims
+	}
+	return claims, nil
+}
+
+// FailureReason - short identifier of the reason why an authentication failed, suitable as a metric label
+func FailureReason(err error) string {
+	switch err {
+	case errorEmptyRequestToken:
+		return "missing_token"
+	case errorInvalidPublicKey:
+		return "invalid_public_key"
+	case errorInvalidClaims:
+		return "invalid_claims"
+	case errorInvalidApplication:
+		return "missing_application_id"
+	case errorInvalidNamespace:
+		return "missing_namespace_id"
+	}
+	if _, ok := err.(*jwt.ValidationError); ok {
+		return "invalid_token"
 	}
-	return nil
+	return "unknown"
 }
@@ -260,3 +260,56 @@ func TestAuthenticate(t *testing.T) {
 		}
 	})
 }
+
+func TestFailureReason(t *testing.T) {
+	t.Run("missing token", func(t *testing.T) {
+		os.Setenv("SCW_PUBLIC", "false")
+		initEnv()
+		err := Authenticate(httptest.NewRecorder(), newRequest())
+		if reason := FailureReason(err); reason != "missing_token" {
+			t.Errorf("FailureReason() = %s, expected missing_token", reason)
+		}
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		err := setUpAndTestAuthentication("invalid-token")
+		if reason := FailureReason(err); reason != "invalid_token" {
+			t.Errorf("FailureReason() = %s, expected invalid_token", reason)
+		}
+	})
+
+	t.Run("invalid claims", func(t *testing.T) {
+		err := setUpAndTestAuthentication(fixtureTokenTooManyClaims)
+		if reason := FailureReason(err); reason != "invalid_claims" {
+			t.Errorf("FailureReason() = %s, expected invalid_claims", reason)
+		}
+	})
+}
+
+func TestAuthenticateClaims(t *testing.T) {
+	t.Run("function is public", func(t *testing.T) {
+		os.Setenv("SCW_PUBLIC", "true")
+		initEnv()
+		claims, err := AuthenticateClaims(httptest.NewRecorder(), newRequest())
+		if err != nil || claims != nil || claims.Map() != nil {
+			t.Errorf("AuthenticateClaims() = %v %v, expected no claims", claims, err)
+		}
+	})
+
+	t.Run("valid authentication for Application ID", func(t *testing.T) {
+		setUpEnvironmentVariables()
+		req := newRequest()
+		req.Header.Set("SCW-Functions-Token", fixtureTokenApplication)
+		claims, err := AuthenticateClaims(httptest.NewRecorder(), req)
+		if err != nil {
+			t.Fatalf("AuthenticateClaims(), received error %v", err)
+		}
+		applicationClaims, ok := claims.Map()["application_claim"].([]interface{})
+		if !ok || len(applicationClaims) != 1 {
+			t.Fatalf("claims = %v, expected one application claim", claims.Map())
+		}
+		if applicationID := applicationClaims[0].(map[string]interface{})["application_id"]; applicationID != fixtureApplicationID {
+			t.Errorf("application ID = %v, expected %s", applicationID, fixtureApplicationID)
+		}
+	})
+}
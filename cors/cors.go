@@ -0,0 +1,256 @@
+// Package cors implements the Cross-Origin Resource Sharing policy of functions, adding CORS headers to responses
+// and answering preflight requests, see https://fetch.spec.whatwg.org/#http-cors-protocol
+package cors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrorInvalidPolicy - Error type for CORS policies which can not be parsed
+	ErrorInvalidPolicy = errors.New("CORS policy is invalid")
+	// ErrorCredentialsFromAnyOrigin - Error type for CORS policies allowing credentials from origins which are not
+	// pinned to a domain, which would let any website call the function on behalf of its users
+	ErrorCredentialsFromAnyOrigin = errors.New("CORS policy can not allow credentials from any origin, allowed origins must be listed or be subdomains of a fixed domain")
+)
+
+// Policy - origins allowed to call the function from a browser, and what they are allowed to send and read
+type Policy struct {
+	// AllowedOrigins - origins allowed to call the function, "*" allows any origin, and origins may contain
+	// wildcards (e.g. https://*.example.com), no origin is allowed if empty
+	AllowedOrigins []string `json:"allowedOrigins"`
+	// AllowedMethods - methods allowed in cross-origin requests, "*" allows any method
+	AllowedMethods []string `json:"allowedMethods"`
+	// AllowedHeaders - request headers allowed in cross-origin requests, "*" allows any header
+	AllowedHeaders []string `json:"allowedHeaders"`
+	// ExposedHeaders - response headers readable by browsers, besides CORS-safelisted ones
+	ExposedHeaders []string `json:"exposedHeaders"`
+	// AllowCredentials - whether browsers may send cookies and authorization headers with cross-origin requests
+	AllowCredentials bool `json:"allowCredentials"`
+	// MaxAge - time in seconds browsers may cache the result of preflight requests, 0 lets them decide
+	MaxAge int `json:"maxAge"`
+}
+
+// DefaultPolicy - policy of functions which do not configure one, any origin is allowed, as well as the header
+// holding the token of private functions, policies configuring their allowed headers must list it as well
+var DefaultPolicy = Policy{
+	AllowedOrigins: []string{"*"},
+	AllowedMethods: []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+	AllowedHeaders: []string{"Content-Type", tokenHeader},
+}
+
+// tokenHeader - header holding the authentication token of requests to private functions
+const tokenHeader = "SCW-Functions-Token"
+
+// ParsePolicy - parse a JSON policy, fields which are not set keep their value in DefaultPolicy
+func ParsePolicy(data []byte) (Policy, error) {
+	policy := DefaultPolicy
+	// Unmarshal reuses the arrays of slices, which must not be shared with DefaultPolicy
+	policy.AllowedOrigins = append([]string{}, policy.AllowedOrigins...)
+	policy.AllowedMethods = append([]string{}, policy.AllowedMethods...)
+	policy.AllowedHeaders = append([]string{}, policy.AllowedHeaders...)
+	policy.ExposedHeaders = append([]string{}, policy.ExposedHeaders...)
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return Policy{}, ErrorInvalidPolicy
+	}
+	if err := policy.Validate(); err != nil {
+		return Policy{}, err
+	}
+	return policy, nil
+}
+
+// Validate - check that the policy does not allow credentials from any origin, as a policy of only
+// {"allowCredentials": true} would otherwise do with the "*" origin of DefaultPolicy, origins allowed to send
+// credentials must be pinned to a domain, see isPinnedOrigin
+func (p *Policy) Validate() error {
+	if !p.AllowCredentials {
+		return nil
+	}
+	for _, origin := range p.AllowedOrigins {
+		if !isPinnedOrigin(origin) {
+			return fmt.Errorf("%w: %q", ErrorCredentialsFromAnyOrigin, origin)
+		}
+	}
+	return nil
+}
+
+// isPinnedOrigin - whether an origin pattern only matches a fixed origin, or subdomains of a fixed domain with a
+// fixed scheme (e.g. https://*.example.com), rather than origins of any host (e.g. https://*, http*)
+func isPinnedOrigin(pattern string) bool {
+	if !strings.Contains(pattern, "*") {
+		return true
+	}
+	index := strings.Index(pattern, "://")
+	if index <= 0 || strings.Contains(pattern[:index], "*") {
+		return false
+	}
+	host := pattern[index+len("://"):]
+	if !strings.HasPrefix(host, "*.") || strings.Contains(host[len("*."):], "*") {
+		return false
+	}
+	// The domain must have at least two labels, so that *.com is rejected
+	domain := strings.SplitN(host[len("*."):], ":", 2)[0]
+	return strings.Index(domain, ".") > 0 && !strings.HasSuffix(domain, ".")
+}
+
+// ReadPolicy - read a JSON policy from the given file, see ParsePolicy
+func ReadPolicy(path string) (Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Policy{}, err
+	}
+	return ParsePolicy(data)
+}
+
+// SplitList - split a comma-separated list (e.g. of origins), ignoring blank elements
+func SplitList(list string) []string {
+	elements := []string{}
+	for _, element := range strings.Split(list, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+// IsPreflight - whether the request is a CORS preflight request, sent by browsers before cross-origin requests
+func IsPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// ServePreflight - answer preflight requests, without authentication as browsers never send credentials with them,
+// returns false if the request is not a preflight request and must be handled as an invocation
+func (p *Policy) ServePreflight(w http.ResponseWriter, r *http.Request) bool {
+	if !IsPreflight(r) {
+		return false
+	}
+
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+
+	// Disallowed requests are answered without CORS headers, browsers then block the cross-origin request
+	method := r.Header.Get("Access-Control-Request-Method")
+	if p.allowsMethod(method) && p.setOrigin(header, r.Header.Get("Origin")) {
+		if contains(p.AllowedMethods, "*") {
+			header.Set("Access-Control-Allow-Methods", method)
+		} else {
+			header.Set("Access-Control-Allow-Methods", strings.Join(p.AllowedMethods, ", "))
+		}
+		if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" && contains(p.AllowedHeaders, "*") {
+			header.Set("Access-Control-Allow-Headers", requested)
+		} else if len(p.AllowedHeaders) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(p.AllowedHeaders, ", "))
+		}
+		if p.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(p.MaxAge))
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// SetHeaders - add CORS headers to the response of the given request, if its origin is allowed
+func (p *Policy) SetHeaders(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	if !p.allowsAnyOrigin() || p.AllowCredentials {
+		// Responses depend on the origin of the request
+		header.Add("Vary", "Origin")
+	}
+	if !p.setOrigin(header, r.Header.Get("Origin")) {
+		return
+	}
+	if len(p.AllowedHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(p.AllowedHeaders, ", "))
+	}
+	if len(p.ExposedHeaders) > 0 {
+		header.Set("Access-Control-Expose-Headers", strings.Join(p.ExposedHeaders, ", "))
+	}
+}
+
+// setOrigin - set the origin allowed to read the response, returns false if the given origin is not allowed
+func (p *Policy) setOrigin(header http.Header, origin string) bool {
+	switch {
+	case p.allowsAnyOrigin():
+		if p.AllowCredentials {
+			// Invalid policy, see Validate
+			return false
+		}
+		header.Set("Access-Control-Allow-Origin", "*")
+	case origin != "" && p.allowsOrigin(origin):
+		// Browsers reject the "*" wildcard with credentials, the origin of the request is sent instead
+		header.Set("Access-Control-Allow-Origin", origin)
+	default:
+		return false
+	}
+	if p.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+func (p *Policy) allowsAnyOrigin() bool {
+	return contains(p.AllowedOrigins, "*")
+}
+
+func (p *Policy) allowsOrigin(origin string) bool {
+	for _, allowed := range p.AllowedOrigins {
+		if p.AllowCredentials && !isPinnedOrigin(allowed) {
+			// Invalid policy, see Validate
+			continue
+		}
+		if matchWildcard(strings.ToLower(allowed), strings.ToLower(origin)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) allowsMethod(method string) bool {
+	if contains(p.AllowedMethods, "*") {
+		return true
+	}
+	for _, allowed := range p.AllowedMethods {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWildcard - whether value matches the given pattern, in which "*" matches any sequence of characters
+func matchWildcard(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		index := strings.Index(value, part)
+		if index < 0 {
+			return false
+		}
+		value = value[index+len(part):]
+	}
+	return strings.HasSuffix(value, parts[len(parts)-1])
+}
+
+func contains(list []string, value string) bool {
+	for _, element := range list {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
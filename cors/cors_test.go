@@ -0,0 +1,216 @@
+package cors
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		value    string
+		expected bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "https://example.org", false},
+		{"https://*.example.com", "https://app.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://app.example.com.evil.org", false},
+		{"http://localhost:*", "http://localhost:3000", true},
+		{"*", "https://example.com", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.value, func(t *testing.T) {
+			if matched := matchWildcard(test.pattern, test.value); matched != test.expected {
+				t.Errorf("matchWildcard() = %v, expected %v", matched, test.expected)
+			}
+		})
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	restricted := Policy{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		ExposedHeaders:   []string{"X-Request-Id"},
+		AllowCredentials: true,
+	}
+
+	tests := []struct {
+		name                string
+		policy              Policy
+		origin              string
+		expectedOrigin      string
+		expectedHeaders     string
+		expectedExposed     string
+		expectedCredentials string
+	}{
+		{"default without origin", DefaultPolicy, "", "*", "Content-Type, SCW-Functions-Token", "", ""},
+		{"default with origin", DefaultPolicy, "https://example.com", "*", "Content-Type, SCW-Functions-Token", "", ""},
+		{"allowed origin", restricted, "https://app.example.com", "https://app.example.com", "Content-Type, Authorization", "X-Request-Id", "true"},
+		{"disallowed origin", restricted, "https://example.org", "", "", "", ""},
+		{"disabled", Policy{}, "https://example.com", "", "", "", ""},
+		{"credentials from any origin", Policy{AllowedOrigins: []string{"*"}, AllowCredentials: true}, "https://example.com", "", "", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/", nil)
+			if test.origin != "" {
+				request.Header.Set("Origin", test.origin)
+			}
+			recorder := httptest.NewRecorder()
+			test.policy.SetHeaders(recorder, request)
+
+			header := recorder.Header()
+			if header.Get("Access-Control-Allow-Origin") != test.expectedOrigin ||
+				header.Get("Access-Control-Allow-Headers") != test.expectedHeaders ||
+				header.Get("Access-Control-Expose-Headers") != test.expectedExposed ||
+				header.Get("Access-Control-Allow-Credentials") != test.expectedCredentials {
+				t.Errorf("SetHeaders() set %v", header)
+			}
+		})
+	}
+}
+
+func TestServePreflight(t *testing.T) {
+	policy := Policy{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"*"},
+		MaxAge:         600,
+	}
+
+	tests := []struct {
+		name            string
+		method          string
+		origin          string
+		requestMethod   string
+		requestHeaders  string
+		expectedServed  bool
+		expectedOrigin  string
+		expectedMethods string
+		expectedHeaders string
+		expectedMaxAge  string
+	}{
+		{"allowed", http.MethodOptions, "https://example.com", "POST", "Authorization", true, "https://example.com", "GET, POST", "Authorization", "600"},
+		{"disallowed origin", http.MethodOptions, "https://example.org", "POST", "", true, "", "", "", ""},
+		{"disallowed method", http.MethodOptions, "https://example.com", "DELETE", "", true, "", "", "", ""},
+		{"not a preflight", http.MethodOptions, "https://example.com", "", "", false, "", "", "", ""},
+		{"not options", http.MethodPost, "https://example.com", "POST", "", false, "", "", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, "/", nil)
+			request.Header.Set("Origin", test.origin)
+			if test.requestMethod != "" {
+				request.Header.Set("Access-Control-Request-Method", test.requestMethod)
+			}
+			if test.requestHeaders != "" {
+				request.Header.Set("Access-Control-Request-Headers", test.requestHeaders)
+			}
+			recorder := httptest.NewRecorder()
+
+			if served := policy.ServePreflight(recorder, request); served != test.expectedServed {
+				t.Fatalf("ServePreflight() = %v, expected %v", served, test.expectedServed)
+			}
+			if !test.expectedServed {
+				return
+			}
+
+			header := recorder.Header()
+			if recorder.Code != http.StatusNoContent ||
+				header.Get("Access-Control-Allow-Origin") != test.expectedOrigin ||
+				header.Get("Access-Control-Allow-Methods") != test.expectedMethods ||
+				header.Get("Access-Control-Allow-Headers") != test.expectedHeaders ||
+				header.Get("Access-Control-Max-Age") != test.expectedMaxAge {
+				t.Errorf("ServePreflight() answered %d %v", recorder.Code, header)
+			}
+		})
+	}
+
+	t.Run("default policy allows the token of private functions", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodOptions, "/", nil)
+		request.Header.Set("Origin", "https://example.com")
+		request.Header.Set("Access-Control-Request-Method", "POST")
+		request.Header.Set("Access-Control-Request-Headers", "content-type,scw-functions-token")
+		recorder := httptest.NewRecorder()
+		DefaultPolicy.ServePreflight(recorder, request)
+
+		if allowed := recorder.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(allowed, "SCW-Functions-Token") {
+			t.Errorf("Access-Control-Allow-Headers = %q, expected SCW-Functions-Token to be allowed", allowed)
+		}
+	})
+}
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`{"allowedOrigins": ["https://example.com"], "maxAge": 60}`))
+	if err != nil {
+		t.Fatalf("ParsePolicy(), received error %v", err)
+	}
+	if len(policy.AllowedOrigins) != 1 || policy.MaxAge != 60 || len(policy.AllowedHeaders) != len(DefaultPolicy.AllowedHeaders) {
+		t.Errorf("ParsePolicy() = %+v, expected unset fields to keep their default value", policy)
+	}
+
+	if _, err := ParsePolicy([]byte(`{"allowedOrigins": "*"}`)); err != ErrorInvalidPolicy {
+		t.Errorf("ParsePolicy(), received error %v, expected %v", err, ErrorInvalidPolicy)
+	}
+
+	if _, err := ParsePolicy([]byte(`{"allowCredentials": true}`)); !errors.Is(err, ErrorCredentialsFromAnyOrigin) {
+		t.Errorf("ParsePolicy(), received error %v, expected %v with the default origins", err, ErrorCredentialsFromAnyOrigin)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		origin        string
+		expectedValid bool
+	}{
+		{"https://example.com", true},
+		{"https://example.com:8443", true},
+		{"https://*.example.com", true},
+		{"https://*.example.com:8443", true},
+		{"*", false},
+		{"https://*", false},
+		{"*://*", false},
+		{"http*", false},
+		{"*://app.example.com", false},
+		{"https://*.com", false},
+		{"https://*.", false},
+		{"https://*.example.*", false},
+		{"https://app*.example.com", false},
+		{"https://example.com*", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.origin, func(t *testing.T) {
+			policy := Policy{AllowedOrigins: []string{"https://example.org", test.origin}, AllowCredentials: true}
+			err := policy.Validate()
+			if valid := err == nil; valid != test.expectedValid {
+				t.Errorf("Validate(), received error %v, expected valid %v", err, test.expectedValid)
+			}
+			if err != nil && !errors.Is(err, ErrorCredentialsFromAnyOrigin) {
+				t.Errorf("Validate(), received error %v, expected %v", err, ErrorCredentialsFromAnyOrigin)
+			}
+
+			// Invalid policies never send credentials to origins they match
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/", nil)
+			request.Header.Set("Origin", "https://evil.com")
+			policy.SetHeaders(recorder, request)
+			if origin := recorder.Header().Get("Access-Control-Allow-Origin"); origin != "" {
+				t.Errorf("SetHeaders() allowed origin %s with credentials", origin)
+			}
+
+			policy.AllowCredentials = false
+			if err := policy.Validate(); err != nil {
+				t.Errorf("Validate(), received error %v without credentials", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package events
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CloudEvents content modes, see https://github.com/cloudevents/spec/blob/v1.0/http-protocol-binding.md
+const (
+	// CloudEventsContentType - media type of requests holding an event in structured mode
+	CloudEventsContentType = "application/cloudevents+json"
+	// CloudEventsBatchContentType - media type of requests holding a batch of events
+	CloudEventsBatchContentType = "application/cloudevents-batch+json"
+	// cloudEventsHeaderPrefix - prefix of the headers holding event attributes in binary mode
+	cloudEventsHeaderPrefix = "Ce-"
+	// cloudEventsSpecVersion - version of the CloudEvents specification supported by the runtime
+	cloudEventsSpecVersion = "1.0"
+)
+
+// ErrorInvalidCloudEvent - Error type for requests which do not hold valid CloudEvents
+var ErrorInvalidCloudEvent = errors.New("Invalid CloudEvent")
+
+// CloudEvent - event in the CloudEvents 1.0 format, given to handlers of non-HTTP triggers in CloudEvents mode, as
+// a JSON object in the structured mode format
+type CloudEvent struct {
+	SpecVersion     string `json:"specversion"`
+	ID              string `json:"id"`
+	Source          string `json:"source"`
+	Type            string `json:"type"`
+	DataContentType string `json:"datacontenttype,omitempty"`
+	DataSchema      string `json:"dataschema,omitempty"`
+	Subject         string `json:"subject,omitempty"`
+	Time            string `json:"time,omitempty"`
+	// Data - data of the event as JSON, strings for text data
+	Data json.RawMessage `json:"data,omitempty"`
+	// DataBase64 - data of the event which is neither JSON nor text, base64-encoded
+	DataBase64 string `json:"data_base64,omitempty"`
+	// Extensions - extension attributes of the event, set next to the other attributes in JSON
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// cloudEventAttributes - attributes which are not extensions
+var cloudEventAttributes = map[string]bool{
+	"specversion": true, "id": true, "source": true, "type": true, "datacontenttype": true,
+	"dataschema": true, "subject": true, "time": true, "data": true, "data_base64": true,
+}
+
+// cloudEvent - CloudEvent without its JSON methods
+type cloudEvent CloudEvent
+
+// MarshalJSON - encode the event in the structured mode format, extension attributes included
+func (e CloudEvent) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(cloudEvent(e))
+	if err != nil || len(e.Extensions) == 0 {
+		return data, err
+	}
+
+	attributes := map[string]interface{}{}
+	if err := json.Unmarshal(data, &attributes); err != nil {
+		return nil, err
+	}
+	for name, value := range e.Extensions {
+		attributes[name] = value
+	}
+	return json.Marshal(attributes)
+}
+
+// UnmarshalJSON - decode an event in the structured mode format, unknown attributes are extensions
+func (e *CloudEvent) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*cloudEvent)(e)); err != nil {
+		return err
+	}
+
+	attributes := map[string]interface{}{}
+	if err := json.Unmarshal(data, &attributes); err != nil {
+		return err
+	}
+	e.Extensions = nil
+	for name, value := range attributes {
+		if cloudEventAttributes[name] {
+			continue
+		}
+		if e.Extensions == nil {
+			e.Extensions = map[string]interface{}{}
+		}
+		e.Extensions[name] = value
+	}
+	return nil
+}
+
+// Validate - check that the event holds the required attributes, and that its attributes are well-formed
+func (e *CloudEvent) Validate() error {
+	switch {
+	case e.SpecVersion != cloudEventsSpecVersion:
+		return fmt.Errorf("%w: unsupported specversion %q", ErrorInvalidCloudEvent, e.SpecVersion)
+	case e.ID == "":
+		return fmt.Errorf("%w: missing id", ErrorInvalidCloudEvent)
+	case e.Source == "":
+		return fmt.Errorf("%w: missing source", ErrorInvalidCloudEvent)
+	case e.Type == "":
+		return fmt.Errorf("%w: missing type", ErrorInvalidCloudEvent)
+	case e.Data != nil && e.DataBase64 != "":
+		return fmt.Errorf("%w: both data and data_base64 are set", ErrorInvalidCloudEvent)
+	}
+	if e.Time != "" {
+		if _, err := time.Parse(time.RFC3339, e.Time); err != nil {
+			return fmt.Errorf("%w: time %q is not an RFC 3339 timestamp", ErrorInvalidCloudEvent, e.Time)
+		}
+	}
+	for name := range e.Extensions {
+		if !isCloudEventAttributeName(name) {
+			return fmt.Errorf("%w: invalid attribute name %q", ErrorInvalidCloudEvent, name)
+		}
+	}
+	return nil
+}
+
+// isCloudEventAttributeName - attribute names are made of lower-case ASCII letters and digits
+func isCloudEventAttributeName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// formatCloudEvents - parse the CloudEvent held by the request, in binary or structured mode, or the batch of
+// CloudEvents it holds
+func formatCloudEvents(r *http.Request, metadata RequestMetadata) (interface{}, error) {
+	switch cloudEventsMediaType(r) {
+	case CloudEventsContentType:
+		var event CloudEvent
+		if err := readCloudEvents(r, &event); err != nil {
+			return nil, err
+		}
+		return event, event.Validate()
+	case CloudEventsBatchContentType:
+		batch := []CloudEvent{}
+		if err := readCloudEvents(r, &batch); err != nil {
+			return nil, err
+		}
+		for i := range batch {
+			if err := batch[i].Validate(); err != nil {
+				return nil, fmt.Errorf("event %d of batch: %w", i, err)
+			}
+		}
+		return batch, nil
+	default:
+		return formatBinaryCloudEvent(r, metadata)
+	}
+}
+
+// isStructuredCloudEvent - whether the request holds a CloudEvent in structured mode, or a batch of CloudEvents,
+// rather than a CloudEvent in binary mode
+func isStructuredCloudEvent(r *http.Request) bool {
+	mediaType := cloudEventsMediaType(r)
+	return mediaType == CloudEventsContentType || mediaType == CloudEventsBatchContentType
+}
+
+func cloudEventsMediaType(r *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType
+}
+
+func readCloudEvents(r *http.Request, events interface{}) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errors.New("Unable to read request body")
+	}
+	if err := json.Unmarshal(body, events); err != nil {
+		return fmt.Errorf("%w: %v", ErrorInvalidCloudEvent, err)
+	}
+	return nil
+}
+
+// formatBinaryCloudEvent - event whose attributes are held by Ce- headers and data by the request body, which is not
+// read when it is streamed
+func formatBinaryCloudEvent(r *http.Request, metadata RequestMetadata) (CloudEvent, error) {
+	event := CloudEvent{DataContentType: r.Header.Get("Content-Type")}
+	for key, values := range r.Header {
+		if !strings.HasPrefix(key, cloudEventsHeaderPrefix) || len(values) == 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(key, cloudEventsHeaderPrefix))
+		// Header values are percent-encoded, see https://github.com/cloudevents/spec/blob/v1.0/http-protocol-binding.md#3132-http-header-values
+		value, err := url.PathUnescape(values[0])
+		if err != nil {
+			return CloudEvent{}, fmt.Errorf("%w: invalid percent-encoding of %s header", ErrorInvalidCloudEvent, key)
+		}
+		switch name {
+		case "specversion":
+			event.SpecVersion = value
+		case "id":
+			event.ID = value
+		case "source":
+			event.Source = value
+		case "type":
+			event.Type = value
+		case "dataschema":
+			event.DataSchema = value
+		case "subject":
+			event.Subject = value
+		case "time":
+			event.Time = value
+		case "datacontenttype", "data", "data_base64":
+			// Not attributes in binary mode
+		default:
+			if event.Extensions == nil {
+				event.Extensions = map[string]interface{}{}
+			}
+			event.Extensions[name] = value
+		}
+	}
+	if err := event.Validate(); err != nil {
+		return CloudEvent{}, err
+	}
+	if r.Body == nil || metadata.StreamBody {
+		return event, nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return CloudEvent{}, errors.New("Unable to read request body")
+	}
+	event.SetData(body, metadata.TextContentTypes)
+	return event, nil
+}
+
+// SetData - set the data of the event from the body of a binary mode request, JSON data is set as-is, text data
+// as a string, and other data base64-encoded, text media types being DefaultTextContentTypes if nil
+func (e *CloudEvent) SetData(body []byte, textContentTypes []string) {
+	e.Data, e.DataBase64 = nil, ""
+	if len(body) == 0 {
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(e.DataContentType)
+	switch {
+	case (e.DataContentType == "" || matchMediaType("application/json", mediaType) || matchMediaType("*/*+json", mediaType)) && json.Valid(body):
+		e.Data = body
+	case IsTextBody(e.DataContentType, string(body), textContentTypes):
+		e.Data, _ = json.Marshal(string(body))
+	default:
+		e.DataBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+}
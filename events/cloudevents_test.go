@@ -0,0 +1,166 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormatCloudEvents(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		headers     map[string]string
+		body        string
+		stream      bool
+		expected    interface{}
+		expectedErr bool
+	}{
+		{
+			name:        "binary mode with JSON data",
+			contentType: "application/json",
+			headers:     map[string]string{"Ce-Specversion": "1.0", "Ce-Id": "1", "Ce-Source": "/orders", "Ce-Type": "order.created", "Ce-Tenant": "acme"},
+			body:        `{"order": 42}`,
+			expected: CloudEvent{
+				SpecVersion: "1.0", ID: "1", Source: "/orders", Type: "order.created", DataContentType: "application/json",
+				Data: json.RawMessage(`{"order": 42}`), Extensions: map[string]interface{}{"tenant": "acme"},
+			},
+		},
+		{
+			name:        "binary mode with text data",
+			contentType: "text/plain",
+			headers:     map[string]string{"Ce-Specversion": "1.0", "Ce-Id": "1", "Ce-Source": "/orders", "Ce-Type": "order.created"},
+			body:        "hello",
+			expected: CloudEvent{
+				SpecVersion: "1.0", ID: "1", Source: "/orders", Type: "order.created", DataContentType: "text/plain",
+				Data: json.RawMessage(`"hello"`),
+			},
+		},
+		{
+			name:        "binary mode with binary data",
+			contentType: "application/octet-stream",
+			headers:     map[string]string{"Ce-Specversion": "1.0", "Ce-Id": "1", "Ce-Source": "/orders", "Ce-Type": "order.created"},
+			body:        "\x00\x01",
+			expected: CloudEvent{
+				SpecVersion: "1.0", ID: "1", Source: "/orders", Type: "order.created", DataContentType: "application/octet-stream",
+				DataBase64: "AAE=",
+			},
+		},
+		{
+			name:        "binary mode with streamed data",
+			contentType: "application/json",
+			headers:     map[string]string{"Ce-Specversion": "1.0", "Ce-Id": "1", "Ce-Source": "/orders", "Ce-Type": "order.created"},
+			body:        `{"order": 42}`,
+			stream:      true,
+			expected:    CloudEvent{SpecVersion: "1.0", ID: "1", Source: "/orders", Type: "order.created", DataContentType: "application/json"},
+		},
+		{
+			name:    "binary mode with percent-encoded attributes",
+			headers: map[string]string{"Ce-Specversion": "1.0", "Ce-Id": "1", "Ce-Source": "%2Forders", "Ce-Type": "order.created", "Ce-Tenant": "caf%C3%A9+bar"},
+			expected: CloudEvent{
+				SpecVersion: "1.0", ID: "1", Source: "/orders", Type: "order.created",
+				Extensions: map[string]interface{}{"tenant": "café+bar"},
+			},
+		},
+		{
+			name:        "binary mode with invalid percent-encoding",
+			headers:     map[string]string{"Ce-Specversion": "1.0", "Ce-Id": "1", "Ce-Source": "/orders%zz", "Ce-Type": "order.created"},
+			expectedErr: true,
+		},
+		{
+			name:        "binary mode without type",
+			headers:     map[string]string{"Ce-Specversion": "1.0", "Ce-Id": "1", "Ce-Source": "/orders"},
+			expectedErr: true,
+		},
+		{
+			name:        "unsupported specversion",
+			headers:     map[string]string{"Ce-Specversion": "0.3", "Ce-Id": "1", "Ce-Source": "/orders", "Ce-Type": "order.created"},
+			expectedErr: true,
+		},
+		{
+			name:        "structured mode",
+			contentType: "application/cloudevents+json; charset=utf-8",
+			body:        `{"specversion": "1.0", "id": "1", "source": "/orders", "type": "order.created", "time": "2021-03-04T11:30:15Z", "data": [1, 2], "tenant": "acme"}`,
+			expected: CloudEvent{
+				SpecVersion: "1.0", ID: "1", Source: "/orders", Type: "order.created", Time: "2021-03-04T11:30:15Z",
+				Data: json.RawMessage(`[1, 2]`), Extensions: map[string]interface{}{"tenant": "acme"},
+			},
+		},
+		{
+			name:        "structured mode with invalid time",
+			contentType: "application/cloudevents+json",
+			body:        `{"specversion": "1.0", "id": "1", "source": "/orders", "type": "order.created", "time": "yesterday"}`,
+			expectedErr: true,
+		},
+		{
+			name:        "structured mode with invalid JSON",
+			contentType: "application/cloudevents+json",
+			body:        `{"specversion"`,
+			expectedErr: true,
+		},
+		{
+			name:        "batch",
+			contentType: "application/cloudevents-batch+json",
+			body:        `[{"specversion": "1.0", "id": "1", "source": "/orders", "type": "order.created"}, {"specversion": "1.0", "id": "2", "source": "/orders", "type": "order.deleted"}]`,
+			expected: []CloudEvent{
+				{SpecVersion: "1.0", ID: "1", Source: "/orders", Type: "order.created"},
+				{SpecVersion: "1.0", ID: "2", Source: "/orders", Type: "order.deleted"},
+			},
+		},
+		{
+			name:        "batch with invalid event",
+			contentType: "application/cloudevents-batch+json",
+			body:        `[{"specversion": "1.0", "id": "1", "source": "/orders", "type": "order.created"}, {"specversion": "1.0", "id": "2"}]`,
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+			if test.contentType != "" {
+				request.Header.Set("Content-Type", test.contentType)
+			}
+			for key, value := range test.headers {
+				request.Header.Set(key, value)
+			}
+
+			event, err := FormatEvent(request, TriggerTypeMQTT, RequestMetadata{CloudEvents: true, StreamBody: test.stream})
+			if test.expectedErr {
+				if !errors.Is(err, ErrorInvalidCloudEvent) {
+					t.Errorf("FormatEvent() error = %v, expected %v", err, ErrorInvalidCloudEvent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FormatEvent(), received error %v", err)
+			}
+			if !reflect.DeepEqual(event, test.expected) {
+				t.Errorf("event = %+v, expected %+v", event, test.expected)
+			}
+		})
+	}
+}
+
+func TestCloudEventJSON(t *testing.T) {
+	event := CloudEvent{
+		SpecVersion: "1.0", ID: "1", Source: "/orders", Type: "order.created",
+		Data: json.RawMessage(`{"order":42}`), Extensions: map[string]interface{}{"tenant": "acme"},
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("json.Marshal(), received error %v", err)
+	}
+	expected := `{"data":{"order":42},"id":"1","source":"/orders","specversion":"1.0","tenant":"acme","type":"order.created"}`
+	if string(data) != expected {
+		t.Errorf("json.Marshal() = %s, expected %s", data, expected)
+	}
+
+	var decoded CloudEvent
+	if err := json.Unmarshal(data, &decoded); err != nil || !reflect.DeepEqual(decoded, event) {
+		t.Errorf("json.Unmarshal() = %+v %v, expected %+v", decoded, err, event)
+	}
+}
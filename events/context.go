@@ -3,11 +3,12 @@ package events
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 var (
 	memoryLimitInMb int
-	functionName string
+	functionName    string
 	functionVersion string
 )
 
@@ -16,21 +17,38 @@ const (
 )
 
 // ExecutionContext - type for the context of execution of the function including memory, function name and version...
-type ExecutionContext struct{
-	MemoryLimitInMB int `json:"memoryLimitInMb"`
-	FunctionName string `json:"functionName"`
+type ExecutionContext struct {
+	MemoryLimitInMB int    `json:"memoryLimitInMb"`
+	FunctionName    string `json:"functionName"`
 	FunctionVersion string `json:"functionVersion"`
+	// Absolute deadline of the invocation, as milliseconds since Unix epoch, sub-runtimes use it to
+	// compute the remaining execution time of the handler
+	Deadline int64 `json:"deadline,omitempty"`
+	// Unique identifier of the invocation, also sent to the caller in the X-Request-Id response header
+	InvocationID string `json:"invocationId,omitempty"`
 }
 
 // GetExecutionContext - retrieve the execution context of the current function
 func GetExecutionContext() ExecutionContext {
 	return ExecutionContext{
 		MemoryLimitInMB: memoryLimitInMb,
-		FunctionName: functionName,
+		FunctionName:    functionName,
 		FunctionVersion: functionVersion,
 	}
 }
 
+// WithDeadline - set the absolute deadline of the invocation in the execution context
+func (c ExecutionContext) WithDeadline(deadline time.Time) ExecutionContext {
+	c.Deadline = deadline.UnixNano() / int64(time.Millisecond)
+	return c
+}
+
+// WithInvocationID - set the unique identifier of the invocation in the execution context
+func (c ExecutionContext) WithInvocationID(invocationID string) ExecutionContext {
+	c.InvocationID = invocationID
+	return c
+}
+
 func init() {
 	var err error
 	memoryLimitInMb, err = strconv.Atoi(os.Getenv("SCW_APPLICATION_MEMORY"))
@@ -0,0 +1,22 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExecutionContextWithDeadline(t *testing.T) {
+	deadline := time.Date(2021, time.March, 4, 10, 30, 15, 123456789, time.UTC)
+	executionContext := GetExecutionContext().WithDeadline(deadline)
+
+	// Deadline is in milliseconds since Unix epoch, sub-milliseconds are truncated
+	if executionContext.Deadline != 1614853815123 {
+		t.Errorf("Deadline = %d, expected 1614853815123", executionContext.Deadline)
+	}
+	if remaining := time.Unix(0, executionContext.Deadline*int64(time.Millisecond)); !remaining.Equal(deadline.Truncate(time.Millisecond)) {
+		t.Errorf("Deadline is %v once converted back, expected %v", remaining, deadline.Truncate(time.Millisecond))
+	}
+	if GetExecutionContext().Deadline != 0 {
+		t.Error("WithDeadline() should not modify the execution context of the function")
+	}
+}
@@ -0,0 +1,68 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Headers of the requests of cron triggers, sent by the scheduler
+const (
+	// HeaderCronSchedule - cron expression of the schedule which triggered the invocation (e.g. "*/5 * * * *")
+	HeaderCronSchedule = "SCW_CRON_SCHEDULE"
+	// HeaderCronScheduledTime - time the invocation was scheduled at, as an RFC 3339 timestamp
+	HeaderCronScheduledTime = "SCW_CRON_SCHEDULED_TIME"
+)
+
+// ErrorInvalidCronEvent - Error type for requests of cron triggers which can not be formatted as an event
+var ErrorInvalidCronEvent = errors.New("Invalid cron event")
+
+// CronEvent - event given to handlers of cron triggers
+type CronEvent struct {
+	// Schedule - cron expression of the schedule which triggered the invocation
+	Schedule string `json:"schedule"`
+	// ScheduledTime - time the invocation was scheduled at, as an RFC 3339 timestamp, empty if unknown
+	ScheduledTime string `json:"scheduledTime,omitempty"`
+	// FireTime - time the invocation actually started, as an RFC 3339 timestamp
+	FireTime string `json:"fireTime"`
+	// Args - JSON arguments of the schedule, the request body, an empty object if there are none
+	Args json.RawMessage `json:"args"`
+}
+
+// formatCronEvent - event of a cron trigger, its arguments are read from the request body even when bodies are
+// streamed, as they are part of the event
+func formatCronEvent(r *http.Request, metadata RequestMetadata) (CronEvent, error) {
+	event := CronEvent{
+		Schedule: r.Header.Get(HeaderCronSchedule),
+		FireTime: receivedAt(metadata).Format(time.RFC3339Nano),
+		Args:     json.RawMessage("{}"),
+	}
+	if event.Schedule == "" {
+		return CronEvent{}, fmt.Errorf("%w: missing %s header", ErrorInvalidCronEvent, HeaderCronSchedule)
+	}
+
+	if scheduledTime := r.Header.Get(HeaderCronScheduledTime); scheduledTime != "" {
+		parsed, err := time.Parse(time.RFC3339, scheduledTime)
+		if err != nil {
+			return CronEvent{}, fmt.Errorf("%w: %s %q is not an RFC 3339 timestamp", ErrorInvalidCronEvent, HeaderCronScheduledTime, scheduledTime)
+		}
+		event.ScheduledTime = parsed.UTC().Format(time.RFC3339)
+	}
+
+	if r.Body != nil {
+		args, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return CronEvent{}, errors.New("Unable to read request body")
+		}
+		if len(args) > 0 {
+			if !json.Valid(args) {
+				return CronEvent{}, fmt.Errorf("%w: arguments are not valid JSON", ErrorInvalidCronEvent)
+			}
+			event.Args = args
+		}
+	}
+	return event, nil
+}
@@ -0,0 +1,73 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatCronEvent(t *testing.T) {
+	receivedAt := time.Date(2021, time.March, 4, 11, 30, 0, 250000000, time.UTC)
+
+	tests := []struct {
+		name          string
+		schedule      string
+		scheduledTime string
+		body          string
+		expected      CronEvent
+		expectedErr   bool
+	}{
+		{
+			name:          "with arguments",
+			schedule:      "*/5 * * * *",
+			scheduledTime: "2021-03-04T12:30:00+01:00",
+			body:          `{"report": "daily"}`,
+			expected:      CronEvent{Schedule: "*/5 * * * *", ScheduledTime: "2021-03-04T11:30:00Z", FireTime: "2021-03-04T11:30:00.25Z", Args: json.RawMessage(`{"report": "daily"}`)},
+		},
+		{
+			name:     "without arguments",
+			schedule: "@hourly",
+			expected: CronEvent{Schedule: "@hourly", FireTime: "2021-03-04T11:30:00.25Z", Args: json.RawMessage(`{}`)},
+		},
+		{name: "without schedule", body: `{}`, expectedErr: true},
+		{name: "invalid scheduled time", schedule: "@hourly", scheduledTime: "noon", expectedErr: true},
+		{name: "invalid arguments", schedule: "@hourly", body: `{"report"`, expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+			request.Header.Set(HeaderCronSchedule, test.schedule)
+			request.Header.Set(HeaderCronScheduledTime, test.scheduledTime)
+
+			event, err := FormatEvent(request, TriggerTypeCron, RequestMetadata{ReceivedAt: receivedAt, CloudEvents: true})
+			if test.expectedErr {
+				if !errors.Is(err, ErrorInvalidCronEvent) {
+					t.Errorf("FormatEvent() error = %v, expected %v", err, ErrorInvalidCronEvent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FormatEvent(), received error %v", err)
+			}
+			if !reflect.DeepEqual(event, test.expected) {
+				t.Errorf("event = %+v, expected %+v", event, test.expected)
+			}
+		})
+	}
+}
+
+func TestGetTriggerType(t *testing.T) {
+	for name, expected := range map[string]TriggerType{"": TriggerTypeHTTP, "mqtt": TriggerTypeMQTT, "cron": TriggerTypeCron} {
+		if triggerType, err := GetTriggerType(name); err != nil || triggerType != expected {
+			t.Errorf("GetTriggerType(%q) = %q %v, expected %q", name, triggerType, err, expected)
+		}
+	}
+	if _, err := GetTriggerType("sqs"); err != ErrorNotSupportedTrigger {
+		t.Errorf("GetTriggerType(sqs) error = %v, expected %v", err, ErrorNotSupportedTrigger)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"time"
 )
 
 var (
@@ -11,8 +12,10 @@ var (
 	TriggerTypeMQTT TriggerType = "mqtt"
 	// TriggerTypeHTTP - Event trigger of type HTTP
 	TriggerTypeHTTP TriggerType = "http"
+	// TriggerTypeCron - Event trigger of type CRON - scheduled invocations
+	TriggerTypeCron TriggerType = "cron"
 	// ValidTriggerTypes - List of supported trigger types
-	ValidTriggerTypes = []TriggerType{TriggerTypeMQTT}
+	ValidTriggerTypes = []TriggerType{TriggerTypeMQTT, TriggerTypeCron}
 	// ErrorNotSupportedTrigger - Error when event is assigned to not supported trigger types
 	ErrorNotSupportedTrigger = errors.New("Trigger Type is not supported by Scaleway Functions Runtime")
 )
@@ -35,11 +38,71 @@ func GetTriggerType(triggerType string) (trigger TriggerType, err error) {
 	return "", ErrorNotSupportedTrigger
 }
 
+// RequestMetadata - information about the invocation, determined by the core runtime, to include in events
+type RequestMetadata struct {
+	// RequestID - unique identifier of the invocation
+	RequestID string
+	// StreamBody - whether the request body is streamed to the sub-runtime separately, it is then not read
+	// into the event
+	StreamBody bool
+	// HeaderCase - casing of header names in HTTP events, canonical if empty, header names of EventFormatV2
+	// events are always lower-cased
+	HeaderCase HeaderCase
+	// CloudEvents - whether requests of non-HTTP triggers, other than cron triggers, hold CloudEvents, which are
+	// then parsed and validated
+	CloudEvents bool
+	// EventFormat - payload format of HTTP events, EventFormatV1 if empty
+	EventFormat EventFormat
+	// TextContentTypes - media types of request bodies passed as text in HTTP events, others are base64-encoded,
+	// DefaultTextContentTypes if nil
+	TextContentTypes []string
+	// ReceivedAt - time the request was received, now if zero
+	ReceivedAt time.Time
+	// SourceIP - IP address of the client which sent the request, past trusted proxies
+	SourceIP string
+	// Claims - claims of the validated authentication token of the request, nil for public functions
+	Claims map[string]interface{}
+	// Stage, APIID and AccountID - identify the deployment of the function in the request context of HTTP events
+	Stage     string
+	APIID     string
+	AccountID string
+}
+
+// BodyStreamed - whether FormatEvent leaves the body of the request unread, for it to be streamed to the
+// sub-runtime: bodies are streamed when metadata.StreamBody is set, unless they are part of the event (arguments
+// of cron triggers, CloudEvents in structured or batch mode)
+func BodyStreamed(req *http.Request, triggerType TriggerType, metadata RequestMetadata) bool {
+	switch {
+	case !metadata.StreamBody:
+		return false
+	case triggerType == TriggerTypeHTTP:
+		return true
+	case triggerType == TriggerTypeCron:
+		return false
+	case metadata.CloudEvents:
+		return !isStructuredCloudEvent(req)
+	default:
+		return true
+	}
+}
+
 // FormatEvent - Format event according to given trigger type, if trigger type if not HTTP, then we assume that event
 // has already been formatted by event-source
-func FormatEvent(req *http.Request, triggerType TriggerType) (interface{}, error) {
+func FormatEvent(req *http.Request, triggerType TriggerType, metadata RequestMetadata) (interface{}, error) {
 	if triggerType == TriggerTypeHTTP {
-		return formatEventHTTP(req), nil
+		if metadata.EventFormat == EventFormatV2 {
+			return formatEventHTTPV2(req, metadata), nil
+		}
+		return formatEventHTTP(req, metadata), nil
+	}
+	if triggerType == TriggerTypeCron {
+		return formatCronEvent(req, metadata)
+	}
+	if metadata.CloudEvents {
+		return formatCloudEvents(req, metadata)
+	}
+	if metadata.StreamBody {
+		return "", nil
 	}
 	// request body is the event
 	reqBody, err := ioutil.ReadAll(req.Body)
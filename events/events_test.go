@@ -0,0 +1,34 @@
+package events
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBodyStreamed(t *testing.T) {
+	tests := []struct {
+		name        string
+		triggerType TriggerType
+		contentType string
+		metadata    RequestMetadata
+		expected    bool
+	}{
+		{"not streamed", TriggerTypeHTTP, "", RequestMetadata{}, false},
+		{"http", TriggerTypeHTTP, "", RequestMetadata{StreamBody: true}, true},
+		{"raw event", TriggerTypeMQTT, "", RequestMetadata{StreamBody: true}, true},
+		{"cron arguments", TriggerTypeCron, "", RequestMetadata{StreamBody: true}, false},
+		{"binary CloudEvent", TriggerTypeMQTT, "application/json", RequestMetadata{StreamBody: true, CloudEvents: true}, true},
+		{"structured CloudEvent", TriggerTypeMQTT, CloudEventsContentType, RequestMetadata{StreamBody: true, CloudEvents: true}, false},
+		{"batch of CloudEvents", TriggerTypeMQTT, CloudEventsBatchContentType, RequestMetadata{StreamBody: true, CloudEvents: true}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/", nil)
+			request.Header.Set("Content-Type", test.contentType)
+			if streamed := BodyStreamed(request, test.triggerType, test.metadata); streamed != test.expected {
+				t.Errorf("BodyStreamed() = %v, expected %v", streamed, test.expected)
+			}
+		})
+	}
+}
@@ -3,8 +3,15 @@ package events
 import (
 	"encoding/base64"
 	"io/ioutil"
-	"log"
+	"mime"
+	"net"
 	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/scaleway/functions-runtime/logging"
 )
 
 // APIGatewayProxyRequest contains data coming from the API Gateway proxy
@@ -26,60 +33,223 @@ type APIGatewayProxyRequest struct {
 // APIGatewayProxyRequestContext contains the information to identify the AWS account and resources invoking the
 // Lambda function. It also includes Cognito identity information for the caller.
 type APIGatewayProxyRequestContext struct {
-	AccountID    string                 `json:"accountId"`
-	ResourceID   string                 `json:"resourceId"`
-	Stage        string                 `json:"stage"`
-	RequestID    string                 `json:"requestId"`
-	ResourcePath string                 `json:"resourcePath"`
-	Authorizer   map[string]interface{} `json:"authorizer"`
-	HTTPMethod   string                 `json:"httpMethod"`
-	APIID        string                 `json:"apiId"` // The API Gateway rest API Id
+	AccountID    string                    `json:"accountId"`
+	ResourceID   string                    `json:"resourceId"`
+	Stage        string                    `json:"stage"`
+	RequestID    string                    `json:"requestId"`
+	ResourcePath string                    `json:"resourcePath"`
+	Authorizer   map[string]interface{}    `json:"authorizer"`
+	HTTPMethod   string                    `json:"httpMethod"`
+	APIID        string                    `json:"apiId"` // The API Gateway rest API Id
+	Identity     APIGatewayRequestIdentity `json:"identity"`
+	Path         string                    `json:"path"`
+	Protocol     string                    `json:"protocol"`
+	DomainName   string                    `json:"domainName"`
+	// RequestTime - time the request was received, in the CLF format (e.g. 02/Jan/2006:15:04:05 +0000)
+	RequestTime string `json:"requestTime"`
+	// RequestTimeEpoch - time the request was received, as milliseconds since Unix epoch
+	RequestTimeEpoch int64 `json:"requestTimeEpoch"`
+}
+
+// APIGatewayRequestIdentity contains identity information about the caller
+type APIGatewayRequestIdentity struct {
+	SourceIP  string `json:"sourceIp"`
+	UserAgent string `json:"userAgent"`
+}
+
+// requestTimeFormat - format of request times in events, the Common Log Format used by API Gateway
+const requestTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// HeaderCase - casing of header names in HTTP events
+type HeaderCase string
+
+// Supported header casings
+const (
+	// HeaderCaseCanonical - header names are canonicalized (e.g. Content-Type), the default
+	HeaderCaseCanonical HeaderCase = "canonical"
+	// HeaderCaseLower - header names are lower-cased (e.g. content-type), as with HTTP/2 and API Gateway HTTP APIs
+	HeaderCaseLower HeaderCase = "lower"
+)
+
+// ParseHeaderCase - parse a header casing name, returns false if it is unknown
+func ParseHeaderCase(name string) (HeaderCase, bool) {
+	switch HeaderCase(strings.ToLower(name)) {
+	case HeaderCaseCanonical:
+		return HeaderCaseCanonical, true
+	case HeaderCaseLower:
+		return HeaderCaseLower, true
+	}
+	return HeaderCaseCanonical, false
+}
+
+// name - header name with this casing
+func (c HeaderCase) name(key string) string {
+	if c == HeaderCaseLower {
+		return strings.ToLower(key)
+	}
+	return textproto.CanonicalMIMEHeaderKey(key)
+}
+
+// DefaultTextContentTypes - media types of request bodies passed as text in HTTP events, when no other list is
+// configured, bodies of other types are base64-encoded
+var DefaultTextContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/*+json",
+	"application/xml",
+	"application/*+xml",
+	"application/javascript",
+	"application/x-www-form-urlencoded",
+	"application/graphql",
+	"application/x-ndjson",
+}
+
+// IsTextBody - whether a body can be passed as text in an HTTP event: its content type must be one of the given
+// text types (e.g. "text/*", "application/*+json"), or be unknown, and it must be valid UTF-8
+func IsTextBody(contentType, body string, textContentTypes []string) bool {
+	if !utf8.ValidString(body) {
+		return false
+	}
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	if textContentTypes == nil {
+		textContentTypes = DefaultTextContentTypes
+	}
+	for _, pattern := range textContentTypes {
+		if matchMediaType(strings.ToLower(pattern), mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMediaType - whether a media type matches the given pattern, whose type or subtype may be "*", and whose
+// subtype may be a structured syntax suffix (e.g. "*+json")
+func matchMediaType(pattern, mediaType string) bool {
+	patternType := strings.SplitN(pattern, "/", 2)
+	typeAndSubtype := strings.SplitN(mediaType, "/", 2)
+	if len(patternType) != 2 || len(typeAndSubtype) != 2 {
+		return pattern == mediaType
+	}
+	if patternType[0] != "*" && patternType[0] != typeAndSubtype[0] {
+		return false
+	}
+
+	switch subtype := patternType[1]; {
+	case subtype == "*":
+		return true
+	case strings.HasPrefix(subtype, "*+"):
+		return strings.HasSuffix(typeAndSubtype[1], subtype[1:])
+	default:
+		return subtype == typeAndSubtype[1]
+	}
 }
 
-func formatEventHTTP(r *http.Request) APIGatewayProxyRequest {
+// readEventBody - body of the request as given in HTTP events, and whether it is base64-encoded
+func readEventBody(r *http.Request, metadata RequestMetadata) (string, bool) {
 	var input string
 
-	if r.Body != nil {
+	if r.Body != nil && !metadata.StreamBody {
 		defer r.Body.Close()
 
 		bodyBytes, bodyErr := ioutil.ReadAll(r.Body)
 
 		if bodyErr != nil {
-			log.Printf("Error reading body from request.")
+			logging.Errorf("Error reading body from request: %v", bodyErr)
 		}
 
 		input = string(bodyBytes)
 	}
 
+	// Streamed bodies are sent raw, after the event
+	if input != "" && !IsTextBody(r.Header.Get("Content-Type"), input, metadata.TextContentTypes) {
+		return base64.StdEncoding.EncodeToString([]byte(input)), true
+	}
+	return input, false
+}
+
+// receivedAt - time the request was received, in UTC
+func receivedAt(metadata RequestMetadata) time.Time {
+	if metadata.ReceivedAt.IsZero() {
+		return time.Now().UTC()
+	}
+	return metadata.ReceivedAt.UTC()
+}
+
+func formatEventHTTP(r *http.Request, metadata RequestMetadata) APIGatewayProxyRequest {
+	input, isBase64Encoded := readEventBody(r, metadata)
+
+	// Single-value maps hold the last value of repeated headers and query parameters, multi-value maps hold all of them
 	headers := map[string]string{}
-	for key, value := range r.Header {
-		headers[key] = value[len(value)-1]
+	multiValueHeaders := map[string][]string{}
+	for key, values := range r.Header {
+		key = metadata.HeaderCase.name(key)
+		multiValueHeaders[key] = append(multiValueHeaders[key], values...)
+		headers[key] = values[len(values)-1]
 	}
 
 	queryParameters := map[string]string{}
-	for key, value := range r.URL.Query() {
-		queryParameters[key] = value[len(value)-1]
+	multiValueQueryParameters := map[string][]string{}
+	for key, values := range r.URL.Query() {
+		multiValueQueryParameters[key] = values
+		queryParameters[key] = values[len(values)-1]
 	}
 
-	isBase64Encoded := true
-	_, err := base64.StdEncoding.DecodeString(input)
-	if err != nil {
-		isBase64Encoded = false
-	}
+	receivedAt := receivedAt(metadata)
 
 	event := APIGatewayProxyRequest{
-		Path:                  r.URL.Path,
-		HTTPMethod:            r.Method,
-		Headers:               headers,
-		QueryStringParameters: queryParameters,
-		StageVariables:        map[string]string{},
-		Body:                  input,
-		IsBase64Encoded:       isBase64Encoded,
+		Resource:                        r.URL.Path,
+		Path:                            r.URL.Path,
+		HTTPMethod:                      r.Method,
+		Headers:                         headers,
+		MultiValueHeaders:               multiValueHeaders,
+		QueryStringParameters:           queryParameters,
+		MultiValueQueryStringParameters: multiValueQueryParameters,
+		StageVariables:                  map[string]string{},
+		Body:                            input,
+		IsBase64Encoded:                 isBase64Encoded,
 		RequestContext: APIGatewayProxyRequestContext{
-			Stage:      "",
-			HTTPMethod: r.Method,
+			AccountID:    metadata.AccountID,
+			Stage:        metadata.Stage,
+			RequestID:    metadata.RequestID,
+			ResourcePath: r.URL.Path,
+			Authorizer:   authorizer(metadata.Claims),
+			HTTPMethod:   r.Method,
+			APIID:        metadata.APIID,
+			Identity: APIGatewayRequestIdentity{
+				SourceIP:  metadata.SourceIP,
+				UserAgent: r.UserAgent(),
+			},
+			Path:             r.URL.Path,
+			Protocol:         r.Proto,
+			DomainName:       domainName(r.Host),
+			RequestTime:      receivedAt.Format(requestTimeFormat),
+			RequestTimeEpoch: receivedAt.UnixNano() / int64(time.Millisecond),
 		},
 	}
 
 	return event
 }
+
+// domainName - host name the request was sent to, without port
+func domainName(host string) string {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		return name
+	}
+	return host
+}
+
+// authorizer - authorizer of the request context, holding the claims of the authentication token as API Gateway
+// JWT authorizers do, nil if the request was not authenticated
+func authorizer(claims map[string]interface{}) map[string]interface{} {
+	if claims == nil {
+		return nil
+	}
+	return map[string]interface{}{"claims": claims}
+}
@@ -0,0 +1,162 @@
+package events
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatEventHTTP(t *testing.T) {
+	tests := []struct {
+		name                   string
+		headerCase             HeaderCase
+		expectedHeaders        map[string]string
+		expectedMultiHeaders   map[string][]string
+		expectedQuery          map[string]string
+		expectedMultiQuery     map[string][]string
+		expectedBody           string
+		expectedBase64, stream bool
+	}{
+		{
+			name:                 "canonical",
+			headerCase:           HeaderCaseCanonical,
+			expectedHeaders:      map[string]string{"Accept": "text/html", "X-Custom": "b"},
+			expectedMultiHeaders: map[string][]string{"Accept": {"text/html"}, "X-Custom": {"a", "b"}},
+			expectedQuery:        map[string]string{"tag": "b", "page": "1"},
+			expectedMultiQuery:   map[string][]string{"tag": {"a", "b"}, "page": {"1"}},
+			expectedBody:         "hello world",
+		},
+		{
+			name:                 "lower",
+			headerCase:           HeaderCaseLower,
+			expectedHeaders:      map[string]string{"accept": "text/html", "x-custom": "b"},
+			expectedMultiHeaders: map[string][]string{"accept": {"text/html"}, "x-custom": {"a", "b"}},
+			expectedQuery:        map[string]string{"tag": "b", "page": "1"},
+			expectedMultiQuery:   map[string][]string{"tag": {"a", "b"}, "page": {"1"}},
+			expectedBody:         "hello world",
+		},
+		{
+			name:                 "streamed body",
+			headerCase:           "",
+			expectedHeaders:      map[string]string{"Accept": "text/html", "X-Custom": "b"},
+			expectedMultiHeaders: map[string][]string{"Accept": {"text/html"}, "X-Custom": {"a", "b"}},
+			expectedQuery:        map[string]string{"tag": "b", "page": "1"},
+			expectedMultiQuery:   map[string][]string{"tag": {"a", "b"}, "page": {"1"}},
+			stream:               true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/path?tag=a&tag=b&page=1", strings.NewReader("hello world"))
+			request.Header.Add("Accept", "text/html")
+			request.Header.Add("x-custom", "a")
+			request.Header.Add("X-Custom", "b")
+
+			event := formatEventHTTP(request, RequestMetadata{RequestID: "id", HeaderCase: test.headerCase, StreamBody: test.stream})
+			if !reflect.DeepEqual(event.Headers, test.expectedHeaders) || !reflect.DeepEqual(event.MultiValueHeaders, test.expectedMultiHeaders) {
+				t.Errorf("headers = %v %v, expected %v %v", event.Headers, event.MultiValueHeaders, test.expectedHeaders, test.expectedMultiHeaders)
+			}
+			if !reflect.DeepEqual(event.QueryStringParameters, test.expectedQuery) || !reflect.DeepEqual(event.MultiValueQueryStringParameters, test.expectedMultiQuery) {
+				t.Errorf("query = %v %v, expected %v %v", event.QueryStringParameters, event.MultiValueQueryStringParameters, test.expectedQuery, test.expectedMultiQuery)
+			}
+			if event.Body != test.expectedBody || event.IsBase64Encoded != test.expectedBase64 {
+				t.Errorf("body = %q (base64 %v), expected %q (base64 %v)", event.Body, event.IsBase64Encoded, test.expectedBody, test.expectedBase64)
+			}
+			if event.RequestContext.RequestID != "id" {
+				t.Errorf("request ID = %q, expected id", event.RequestContext.RequestID)
+			}
+		})
+	}
+}
+
+func TestFormatEventHTTPRequestContext(t *testing.T) {
+	request := httptest.NewRequest("GET", "http://function.example.com:8080/users/42", nil)
+	request.Header.Set("User-Agent", "curl/7.68.0")
+	receivedAt := time.Date(2021, time.March, 4, 12, 30, 15, 0, time.FixedZone("CET", 3600))
+
+	event := formatEventHTTP(request, RequestMetadata{
+		RequestID:  "id",
+		ReceivedAt: receivedAt,
+		SourceIP:   "203.0.113.7",
+		Claims:     map[string]interface{}{"sub": "user"},
+		Stage:      "production",
+		APIID:      "application",
+		AccountID:  "namespace",
+	})
+
+	expected := APIGatewayProxyRequestContext{
+		AccountID:        "namespace",
+		Stage:            "production",
+		RequestID:        "id",
+		ResourcePath:     "/users/42",
+		Authorizer:       map[string]interface{}{"claims": map[string]interface{}{"sub": "user"}},
+		HTTPMethod:       "GET",
+		APIID:            "application",
+		Identity:         APIGatewayRequestIdentity{SourceIP: "203.0.113.7", UserAgent: "curl/7.68.0"},
+		Path:             "/users/42",
+		Protocol:         "HTTP/1.1",
+		DomainName:       "function.example.com",
+		RequestTime:      "04/Mar/2021:11:30:15 +0000",
+		RequestTimeEpoch: 1614857415000,
+	}
+	if !reflect.DeepEqual(event.RequestContext, expected) {
+		t.Errorf("request context = %+v, expected %+v", event.RequestContext, expected)
+	}
+	if event.Resource != "/users/42" {
+		t.Errorf("resource = %q, expected /users/42", event.Resource)
+	}
+
+	if event := formatEventHTTP(request, RequestMetadata{}); event.RequestContext.Authorizer != nil {
+		t.Errorf("authorizer = %v, expected none without claims", event.RequestContext.Authorizer)
+	}
+}
+
+func TestParseHeaderCase(t *testing.T) {
+	for name, expected := range map[string]HeaderCase{"canonical": HeaderCaseCanonical, "LOWER": HeaderCaseLower} {
+		if headerCase, ok := ParseHeaderCase(name); !ok || headerCase != expected {
+			t.Errorf("ParseHeaderCase(%q) = %q %v, expected %q", name, headerCase, ok, expected)
+		}
+	}
+	if _, ok := ParseHeaderCase("title"); ok {
+		t.Error("ParseHeaderCase(title), expected an unknown casing")
+	}
+}
+
+func TestFormatEventHTTPBody(t *testing.T) {
+	tests := []struct {
+		name             string
+		contentType      string
+		body             string
+		textContentTypes []string
+		expectedBody     string
+		expectedBase64   bool
+	}{
+		{"text without content type", "", "test", nil, "test", false},
+		{"plain text", "text/plain; charset=utf-8", "abcd", nil, "abcd", false},
+		{"json", "application/json", `{"key":"value"}`, nil, `{"key":"value"}`, false},
+		{"json suffix", "application/vnd.api+json", `{}`, nil, `{}`, false},
+		{"binary", "image/png", "\x89PNG\r\n", nil, "iVBORw0K", true},
+		{"binary without content type", "", "\xff\xfe", nil, "//4=", true},
+		{"invalid text", "text/plain", "\xff\xfe", nil, "//4=", true},
+		{"octet stream", "application/octet-stream", "abcd", nil, "YWJjZA==", true},
+		{"configured text type", "application/octet-stream", "abcd", []string{"application/octet-stream"}, "abcd", false},
+		{"empty", "image/png", "", nil, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+			if test.contentType != "" {
+				request.Header.Set("Content-Type", test.contentType)
+			}
+
+			event := formatEventHTTP(request, RequestMetadata{TextContentTypes: test.textContentTypes})
+			if event.Body != test.expectedBody || event.IsBase64Encoded != test.expectedBase64 {
+				t.Errorf("body = %q (base64 %v), expected %q (base64 %v)", event.Body, event.IsBase64Encoded, test.expectedBody, test.expectedBase64)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package events
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EventFormat - payload format of HTTP events, as the payload format versions of API Gateway
+type EventFormat string
+
+// Supported event formats
+const (
+	// EventFormatV1 - events of API Gateway REST APIs (APIGatewayProxyRequest), the default
+	EventFormatV1 EventFormat = "1.0"
+	// EventFormatV2 - events of API Gateway HTTP APIs (APIGatewayV2HTTPRequest)
+	EventFormatV2 EventFormat = "2.0"
+)
+
+// ParseEventFormat - parse an event format version (e.g. "2.0", or "v2"), returns false if it is unknown
+func ParseEventFormat(version string) (EventFormat, bool) {
+	switch strings.TrimPrefix(strings.ToLower(version), "v") {
+	case "1", "1.0":
+		return EventFormatV1, true
+	case "2", "2.0":
+		return EventFormatV2, true
+	}
+	return EventFormatV1, false
+}
+
+// defaultRouteKey - route key of events, functions have a single catch-all route
+const defaultRouteKey = "$default"
+
+// APIGatewayV2HTTPRequest contains data coming from the API Gateway HTTP API proxy, in payload format 2.0
+type APIGatewayV2HTTPRequest struct {
+	Version               string                         `json:"version"`
+	RouteKey              string                         `json:"routeKey"`
+	RawPath               string                         `json:"rawPath"`
+	RawQueryString        string                         `json:"rawQueryString"`
+	Cookies               []string                       `json:"cookies,omitempty"`
+	Headers               map[string]string              `json:"headers"`
+	QueryStringParameters map[string]string              `json:"queryStringParameters,omitempty"`
+	PathParameters        map[string]string              `json:"pathParameters,omitempty"`
+	StageVariables        map[string]string              `json:"stageVariables,omitempty"`
+	RequestContext        APIGatewayV2HTTPRequestContext `json:"requestContext"`
+	Body                  string                         `json:"body,omitempty"`
+	IsBase64Encoded       bool                           `json:"isBase64Encoded"`
+}
+
+// APIGatewayV2HTTPRequestContext contains the information to identify the resources invoking the function, and
+// the HTTP request
+type APIGatewayV2HTTPRequestContext struct {
+	RouteKey     string                                    `json:"routeKey"`
+	AccountID    string                                    `json:"accountId"`
+	Stage        string                                    `json:"stage"`
+	RequestID    string                                    `json:"requestId"`
+	Authorizer   *APIGatewayV2HTTPRequestContextAuthorizer `json:"authorizer,omitempty"`
+	APIID        string                                    `json:"apiId"`
+	DomainName   string                                    `json:"domainName"`
+	DomainPrefix string                                    `json:"domainPrefix"`
+	// Time - time the request was received, in the CLF format (e.g. 02/Jan/2006:15:04:05 +0000)
+	Time string `json:"time"`
+	// TimeEpoch - time the request was received, as milliseconds since Unix epoch
+	TimeEpoch int64                                         `json:"timeEpoch"`
+	HTTP      APIGatewayV2HTTPRequestContextHTTPDescription `json:"http"`
+}
+
+// APIGatewayV2HTTPRequestContextAuthorizer contains the claims of the validated authentication token
+type APIGatewayV2HTTPRequestContextAuthorizer struct {
+	JWT APIGatewayV2HTTPRequestContextAuthorizerJWT `json:"jwt"`
+}
+
+// APIGatewayV2HTTPRequestContextAuthorizerJWT contains the claims of a JWT authorizer
+type APIGatewayV2HTTPRequestContextAuthorizerJWT struct {
+	Claims map[string]interface{} `json:"claims"`
+	Scopes []string               `json:"scopes"`
+}
+
+// APIGatewayV2HTTPRequestContextHTTPDescription describes the HTTP request and its caller
+type APIGatewayV2HTTPRequestContextHTTPDescription struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Protocol  string `json:"protocol"`
+	SourceIP  string `json:"sourceIp"`
+	UserAgent string `json:"userAgent"`
+}
+
+// formatEventHTTPV2 - format an event in payload format 2.0, header names are always lower-cased and cookies are
+// passed separately, repeated headers and query parameters are joined with commas
+func formatEventHTTPV2(r *http.Request, metadata RequestMetadata) APIGatewayV2HTTPRequest {
+	input, isBase64Encoded := readEventBody(r, metadata)
+
+	headers := map[string]string{}
+	var cookies []string
+	for key, values := range r.Header {
+		key = strings.ToLower(key)
+		if key == "cookie" {
+			for _, value := range values {
+				for _, cookie := range strings.Split(value, ";") {
+					if cookie = strings.TrimSpace(cookie); cookie != "" {
+						cookies = append(cookies, cookie)
+					}
+				}
+			}
+			continue
+		}
+		if previous, ok := headers[key]; ok {
+			values = append([]string{previous}, values...)
+		}
+		headers[key] = strings.Join(values, ",")
+	}
+
+	var queryParameters map[string]string
+	if query := r.URL.Query(); len(query) > 0 {
+		queryParameters = map[string]string{}
+		for key, values := range query {
+			queryParameters[key] = strings.Join(values, ",")
+		}
+	}
+
+	var authorizer *APIGatewayV2HTTPRequestContextAuthorizer
+	if metadata.Claims != nil {
+		authorizer = &APIGatewayV2HTTPRequestContextAuthorizer{
+			JWT: APIGatewayV2HTTPRequestContextAuthorizerJWT{Claims: metadata.Claims},
+		}
+	}
+
+	receivedAt := receivedAt(metadata)
+	domain := domainName(r.Host)
+
+	return APIGatewayV2HTTPRequest{
+		Version:               string(EventFormatV2),
+		RouteKey:              defaultRouteKey,
+		RawPath:               r.URL.EscapedPath(),
+		RawQueryString:        r.URL.RawQuery,
+		Cookies:               cookies,
+		Headers:               headers,
+		QueryStringParameters: queryParameters,
+		Body:                  input,
+		IsBase64Encoded:       isBase64Encoded,
+		RequestContext: APIGatewayV2HTTPRequestContext{
+			RouteKey:     defaultRouteKey,
+			AccountID:    metadata.AccountID,
+			Stage:        metadata.Stage,
+			RequestID:    metadata.RequestID,
+			Authorizer:   authorizer,
+			APIID:        metadata.APIID,
+			DomainName:   domain,
+			DomainPrefix: strings.SplitN(domain, ".", 2)[0],
+			Time:         receivedAt.Format(requestTimeFormat),
+			TimeEpoch:    receivedAt.UnixNano() / int64(time.Millisecond),
+			HTTP: APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Protocol:  r.Proto,
+				SourceIP:  metadata.SourceIP,
+				UserAgent: r.UserAgent(),
+			},
+		},
+	}
+}
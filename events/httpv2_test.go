@@ -0,0 +1,77 @@
+package events
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatEventHTTPV2(t *testing.T) {
+	request := httptest.NewRequest("POST", "http://function.example.com/users/42?tag=a&tag=b&page=1", strings.NewReader("hello world"))
+	request.Header.Add("Accept", "text/html")
+	request.Header.Add("X-Custom", "a")
+	request.Header.Add("X-Custom", "b")
+	request.Header.Add("Cookie", "session=abc; theme=dark")
+	request.Header.Set("User-Agent", "curl/7.68.0")
+
+	metadata := RequestMetadata{
+		RequestID:   "id",
+		EventFormat: EventFormatV2,
+		ReceivedAt:  time.Date(2021, time.March, 4, 11, 30, 15, 0, time.UTC),
+		SourceIP:    "203.0.113.7",
+		Claims:      map[string]interface{}{"sub": "user"},
+		Stage:       "production",
+		APIID:       "application",
+		AccountID:   "namespace",
+	}
+	event, err := FormatEvent(request, TriggerTypeHTTP, metadata)
+	if err != nil {
+		t.Fatalf("FormatEvent(), received error %v", err)
+	}
+
+	expected := APIGatewayV2HTTPRequest{
+		Version:               "2.0",
+		RouteKey:              "$default",
+		RawPath:               "/users/42",
+		RawQueryString:        "tag=a&tag=b&page=1",
+		Cookies:               []string{"session=abc", "theme=dark"},
+		Headers:               map[string]string{"accept": "text/html", "x-custom": "a,b", "user-agent": "curl/7.68.0"},
+		QueryStringParameters: map[string]string{"tag": "a,b", "page": "1"},
+		Body:                  "hello world",
+		RequestContext: APIGatewayV2HTTPRequestContext{
+			RouteKey:     "$default",
+			AccountID:    "namespace",
+			Stage:        "production",
+			RequestID:    "id",
+			Authorizer:   &APIGatewayV2HTTPRequestContextAuthorizer{JWT: APIGatewayV2HTTPRequestContextAuthorizerJWT{Claims: map[string]interface{}{"sub": "user"}}},
+			APIID:        "application",
+			DomainName:   "function.example.com",
+			DomainPrefix: "function",
+			Time:         "04/Mar/2021:11:30:15 +0000",
+			TimeEpoch:    1614857415000,
+			HTTP: APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    "POST",
+				Path:      "/users/42",
+				Protocol:  "HTTP/1.1",
+				SourceIP:  "203.0.113.7",
+				UserAgent: "curl/7.68.0",
+			},
+		},
+	}
+	if !reflect.DeepEqual(event, expected) {
+		t.Errorf("event = %+v, expected %+v", event, expected)
+	}
+}
+
+func TestParseEventFormat(t *testing.T) {
+	for version, expected := range map[string]EventFormat{"1.0": EventFormatV1, "2.0": EventFormatV2, "v2": EventFormatV2, "V1": EventFormatV1} {
+		if format, ok := ParseEventFormat(version); !ok || format != expected {
+			t.Errorf("ParseEventFormat(%q) = %q %v, expected %q", version, format, ok, expected)
+		}
+	}
+	if _, ok := ParseEventFormat("3.0"); ok {
+		t.Errorf("ParseEventFormat(3.0) succeeded, expected unknown format")
+	}
+}
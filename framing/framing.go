@@ -0,0 +1,83 @@
+// Package framing implements the length-prefixed protocol spoken over the standard input and output
+// of sub-runtimes, as an alternative to HTTP for compiled handlers.
+//
+// Every frame is made of a 1-byte type, the 4-byte big-endian length of its payload, and the payload itself.
+// The core runtime writes an invocation frame holding the JSON request (event, context...) to the sub-runtime
+// standard input, the sub-runtime answers on its standard output with a result frame holding the JSON output of
+// the handler, or with an error frame holding an error message. Sub-runtimes handle one invocation at a time,
+// and must write their logs to their standard error.
+package framing
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Type - kind of a frame
+type Type byte
+
+// Frame types
+const (
+	// TypeInvocation - frame sent by the core runtime, holding an invocation request
+	TypeInvocation Type = 'I'
+	// TypeResult - frame sent by the sub-runtime, holding the output of the handler
+	TypeResult Type = 'R'
+	// TypeError - frame sent by the sub-runtime, holding the message of the error raised by the handler
+	TypeError Type = 'E'
+)
+
+// MaxPayloadSize - size above which a frame is considered invalid, to detect garbage (e.g. logs) on the stream
+const MaxPayloadSize = 1 << 28
+
+// headerSize - size of the type and length of a frame
+const headerSize = 5
+
+// ErrorPayloadTooLarge - Error type for frames larger than MaxPayloadSize
+var ErrorPayloadTooLarge = errors.New("frame payload is too large")
+
+func (t Type) valid() bool {
+	return t == TypeInvocation || t == TypeResult || t == TypeError
+}
+
+// Write a frame of the given type and payload
+func Write(w io.Writer, frameType Type, payload []byte) error {
+	if len(payload) > MaxPayloadSize {
+		return ErrorPayloadTooLarge
+	}
+
+	frame := make([]byte, headerSize+len(payload))
+	frame[0] = byte(frameType)
+	binary.BigEndian.PutUint32(frame[1:headerSize], uint32(len(payload)))
+	copy(frame[headerSize:], payload)
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// Read the next frame, io.EOF is returned if the stream ended between two frames
+func Read(r io.Reader) (Type, []byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, nil, fmt.Errorf("truncated frame header: %v", err)
+		}
+		return 0, nil, err
+	}
+
+	frameType := Type(header[0])
+	if !frameType.valid() {
+		return 0, nil, fmt.Errorf("invalid frame type %q, logs must not be written to the protocol stream", header[0])
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > MaxPayloadSize {
+		return 0, nil, ErrorPayloadTooLarge
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, fmt.Errorf("truncated frame payload: %v", err)
+	}
+	return frameType, payload, nil
+}
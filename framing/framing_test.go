@@ -0,0 +1,54 @@
+package framing
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestReadWrite(t *testing.T) {
+	var stream bytes.Buffer
+	frames := []struct {
+		frameType Type
+		payload   string
+	}{
+		{TypeInvocation, `{"event":{}}`},
+		{TypeResult, ``},
+		{TypeError, `handler failed`},
+	}
+
+	for _, frame := range frames {
+		if err := Write(&stream, frame.frameType, []byte(frame.payload)); err != nil {
+			t.Fatalf("Write(), received error %v", err)
+		}
+	}
+	for _, frame := range frames {
+		frameType, payload, err := Read(&stream)
+		if err != nil || frameType != frame.frameType || string(payload) != frame.payload {
+			t.Errorf("Read() = %q, %q, %v, expected %q, %q", frameType, payload, err, frame.frameType, frame.payload)
+		}
+	}
+	if _, _, err := Read(&stream); err != io.EOF {
+		t.Errorf("Read() at end of stream, received error %v, expected %v", err, io.EOF)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+	}{
+		{"log line", "Hello world\n"},
+		{"truncated header", "R\x00\x00"},
+		{"truncated payload", "R\x00\x00\x00\x05abc"},
+		{"too large", "R\x7f\xff\xff\xff"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := Read(bytes.NewBufferString(test.stream)); err == nil || err == io.EOF {
+				t.Errorf("Read(), received error %v, expected an invalid frame error", err)
+			}
+		})
+	}
+}
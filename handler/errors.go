@@ -8,6 +8,20 @@ import (
 var (
 	// ErrorInvalidHTTPResponseFormat - Error type for mal-formatted responses from user's handlers
 	ErrorInvalidHTTPResponseFormat = errors.New("Handler's results for HTTP response is mal-formatted")
+	// ErrorSubRuntimeCrashed - Error type for invocations aborted because the sub-runtime terminated while handling them
+	ErrorSubRuntimeCrashed = errors.New("Sub-runtime has terminated unexpectedly during handler execution")
+	// ErrorSubRuntimeStopped - Error type for invocations received after the sub-runtime has been stopped
+	ErrorSubRuntimeStopped = errors.New("Sub-runtime has been stopped")
+	// ErrorSubRuntimeNotReady - Error type for invocations received while the sub-runtime is not ready, and did not become ready in time
+	ErrorSubRuntimeNotReady = errors.New("Sub-runtime is not ready to handle invocations")
+	// ErrorExecutionTimeout - Error type for invocations that did not complete before the function timeout
+	ErrorExecutionTimeout = errors.New("Handler execution timed out")
+	// ErrorTooManyInvocations - Error type for invocations rejected because the maximum concurrency is reached and the queue is full
+	ErrorTooManyInvocations = errors.New("Too many concurrent invocations")
+	// ErrorQueueTimeout - Error type for invocations which waited too long in queue for a concurrency slot
+	ErrorQueueTimeout = errors.New("Invocation waited too long in queue")
+	// ErrorStreamingNotSupported - Error type for request bodies streamed to a sub-runtime whose protocol does not support it
+	ErrorStreamingNotSupported = errors.New("Request bodies can not be streamed to the sub-runtime")
 )
 
 func handlerExecutionError(err string) error {
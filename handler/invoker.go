@@ -2,23 +2,34 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
-	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/scaleway/functions-runtime/events"
+	"github.com/scaleway/functions-runtime/logging"
+	"github.com/scaleway/functions-runtime/tracing"
 )
 
 const (
-	retryInterval = time.Millisecond * 50
+	// StreamContentType - Content type of invocations whose request body is streamed after the JSON invocation
+	StreamContentType = "application/vnd.scw.invocation-stream"
+	// DefaultStartupTimeout - Time given to the sub-runtime to become ready when none is configured
+	DefaultStartupTimeout = 10 * time.Second
+	probeTimeout          = time.Second
 )
 
 // CoreRuntimeRequest - Structure for a request from core runtime to sub-runtime with event, context, and handler informations to dynamically import
@@ -27,6 +38,8 @@ type CoreRuntimeRequest struct {
 	Context     events.ExecutionContext `json:"context"`
 	HandlerName string                  `json:"handlerName"`
 	HandlerPath string                  `json:"handlerPath"`
+	// W3C Trace Context (traceparent and tracestate) of the invocation, for sub-runtimes to continue the trace
+	TraceContext map[string]string `json:"traceContext,omitempty"`
 }
 
 // FunctionInvoker - In charge of running sub-runtime processes, and invoke it with all the necessary informations
@@ -37,8 +50,47 @@ type FunctionInvoker struct {
 	HandlerFilePath string
 	HandlerName     string
 	IsBinary        bool
-	client          *http.Client
-	upstreamURL     string
+	// Protocol - How invocations are sent to the sub-runtime, ProtocolHTTP (default), ProtocolStdio or ProtocolLambda
+	Protocol string
+	// RestartPolicy - How the sub-runtime is restarted when it crashes, must be set before calling Start
+	RestartPolicy RestartPolicy
+	// StartupTimeout - Time given to the sub-runtime to become ready, after which it is restarted
+	StartupTimeout time.Duration
+	// HealthPath - Route of the sub-runtime answering once it is ready, if empty the sub-runtime is considered
+	// ready as soon as it accepts connections
+	HealthPath string
+	// MaxConcurrency - Maximum number of invocations executed at once, 0 means no limit, must be set before calling Start
+	MaxConcurrency int
+	// MaxQueueSize - Number of invocations allowed to wait for a slot once MaxConcurrency is reached, others are rejected
+	MaxQueueSize int
+	// QueueTimeout - Maximum time an invocation waits in queue for a slot, 0 means until the invocation is cancelled
+	QueueTimeout time.Duration
+	// MinWorkers - Number of sub-runtime processes always running, must be set before calling Start
+	MinWorkers int
+	// MaxWorkers - Maximum number of sub-runtime processes, workers are added when all of them are busy
+	MaxWorkers int
+	// WorkerIdleTimeout - Time after which an idle worker above MinWorkers is stopped
+	WorkerIdleTimeout time.Duration
+	// WorkerMaxInvocations - Number of invocations after which a worker is recycled, 0 means never
+	WorkerMaxInvocations int
+	// WorkerMaxMemoryGrowth - Growth of the resident memory of a worker since its first invocation, in bytes,
+	// after which it is recycled, 0 means never
+	WorkerMaxMemoryGrowth uint64
+	// StreamRequestBody - Whether request bodies are streamed to the sub-runtime after the invocation, rather than
+	// being part of the event, only supported with ProtocolHTTP, see ExecuteStream
+	StreamRequestBody bool
+	// StderrLevel - Level of lines the sub-runtime writes on its standard error without setting one, LevelInfo by
+	// default as runtimes and web servers write all their logs there
+	StderrLevel logging.Level
+	// FallbackUpstreamURL - TCP URL of sub-runtimes which do not support Unix sockets, when the upstream URL
+	// is a Unix socket (e.g. unix:///run/scw/upstream.sock)
+	FallbackUpstreamURL string
+	// ReservedPorts - Ports used by the core runtime itself (e.g. its server), which workers must not listen on
+	ReservedPorts []int
+	client        *http.Client
+	upstreamURL   string
+	pool          *pool
+	limiter       *limiter
 }
 
 // NewInvoker - Initialize runtime configuration to execute function handler
@@ -46,7 +98,7 @@ type FunctionInvoker struct {
 // runtimeBridgePath - Absolute Path to runtime bridge script to start sub-runtime (e.g. /home/app/index.js)
 // handlerFilePath - Absolute Path to function handler file (e.g. /home/app/function/myFunction.js for JavaScript or /home/app/function/myHandler for a binary file)
 // handlerName - Name of the exported function to use as a Handler (Only for non-compiled languages) to dynamically import function (e.g. handler)
-// upstreamURL - URL to sub-runtime HTTP server (e.g. http://localhost:8081)
+// upstreamURL - URL to sub-runtime HTTP server (e.g. http://localhost:8081), or to its Unix socket (e.g. unix:///run/scw/upstream.sock)
 // isBinaryHandler - Wether function Handler is a binary (Compiled languages)
 func NewInvoker(runtimeBinaryPath, runtimeBridgePath, handlerFilePath, handlerName, upstreamURL string, isBinaryHandler bool) (fn *FunctionInvoker, err error) {
 	// Need binary path => /usr/local/bin/python3
@@ -56,18 +108,258 @@ func NewInvoker(runtimeBinaryPath, runtimeBridgePath, handlerFilePath, handlerNa
 	handlerIsBinary := isBinaryHandler
 
 	return &FunctionInvoker{
-		RuntimeBridge:   runtimeBridgeFile,
-		RuntimeBinary:   runtimeBinary,
-		HandlerFilePath: handlerFilePath,
-		HandlerName:     handlerName,
-		IsBinary:        handlerIsBinary,
-		client:          &http.Client{},
-		upstreamURL:     upstreamURL,
+		RuntimeBridge:       runtimeBridgeFile,
+		RuntimeBinary:       runtimeBinary,
+		HandlerFilePath:     handlerFilePath,
+		HandlerName:         handlerName,
+		IsBinary:            handlerIsBinary,
+		Protocol:            ProtocolHTTP,
+		RestartPolicy:       DefaultRestartPolicy,
+		StartupTimeout:      DefaultStartupTimeout,
+		MinWorkers:          1,
+		MaxWorkers:          1,
+		WorkerIdleTimeout:   DefaultWorkerIdleTimeout,
+		StderrLevel:         logging.LevelInfo,
+		FallbackUpstreamURL: DefaultFallbackUpstreamURL,
+		client:              &http.Client{},
+		upstreamURL:         upstreamURL,
 	}, nil
 }
 
-// Start - a new process starting server
+// Start - the sub-runtime worker processes, every process is supervised and restarted if it crashes
+// Their readiness is actively probed in background, invocations wait for a worker to be ready
 func (fn *FunctionInvoker) Start() error {
+	if fn.Protocol != ProtocolHTTP && fn.Protocol != ProtocolStdio && fn.Protocol != ProtocolLambda {
+		return fmt.Errorf("unknown sub-runtime protocol %q", fn.Protocol)
+	}
+	if fn.StreamRequestBody && fn.Protocol != ProtocolHTTP {
+		return fmt.Errorf("request bodies can not be streamed with the %s protocol", fn.Protocol)
+	}
+	// Processes would be killed before having a chance to become ready
+	if fn.StartupTimeout <= 0 {
+		return fmt.Errorf("startup timeout must be positive, received %v", fn.StartupTimeout)
+	}
+	// Validate upstream URL once, workers listen on the following ports
+	upstreamURL, _ := fn.upstreams()
+	_, firstPort, err := workerUpstream(upstreamURL, 0)
+	if err != nil {
+		return err
+	}
+	if fn.Protocol != ProtocolStdio {
+		if err := fn.checkWorkerPorts(firstPort); err != nil {
+			return err
+		}
+	}
+	if fn.WorkerIdleTimeout <= 0 {
+		fn.WorkerIdleTimeout = DefaultWorkerIdleTimeout
+	}
+
+	fn.pool = newPool(fn.newWorker, fn.MinWorkers, fn.MaxWorkers, fn.WorkerIdleTimeout)
+	fn.pool.maxInvocations = fn.WorkerMaxInvocations
+	fn.pool.maxMemory = fn.WorkerMaxMemoryGrowth
+	fn.limiter = newLimiter(fn.MaxConcurrency, fn.MaxQueueSize, fn.QueueTimeout)
+	return fn.pool.start()
+}
+
+// upstreams - TCP URL and Unix socket path (empty if not configured) the first worker listens on
+func (fn *FunctionInvoker) upstreams() (string, string) {
+	if isUnixSocket(fn.upstreamURL) {
+		return fn.FallbackUpstreamURL, strings.TrimPrefix(fn.upstreamURL, unixScheme)
+	}
+	return fn.upstreamURL, ""
+}
+
+// newWorker - a supervised sub-runtime process listening on the upstream port shifted by the index of the worker,
+// or on its own Unix socket
+func (fn *FunctionInvoker) newWorker(index int) (*worker, error) {
+	upstreamURL, socketPath := fn.upstreams()
+	upstreamURL, port, err := workerUpstream(upstreamURL, index)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &worker{index: index, upstreamURL: upstreamURL, tcpClient: fn.client}
+	if fn.Protocol == ProtocolLambda {
+		// Lambda runtimes only reach the Runtime API over TCP, on the upstream port
+		address, err := lambdaAddress(upstreamURL)
+		if err != nil {
+			return nil, err
+		}
+		w.lambda, err = newLambdaRuntimeAPI(address, func(string) {
+			// Lambda runtimes exit by themselves after reporting an initialization error, make sure of it
+			if p := w.supervisor.running(); p != nil {
+				p.signal(syscall.SIGKILL)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		socketPath = ""
+	}
+	if socketPath != "" {
+		w.socketPath = workerSocket(socketPath, index)
+		w.socketClient = newSocketClient(w.socketPath)
+	}
+	probe := func(ctx context.Context) error {
+		return fn.probe(ctx, w)
+	}
+	// Processes speaking over their standard input and output can be invoked as soon as they are started
+	if fn.Protocol == ProtocolStdio {
+		probe = nil
+	}
+	w.supervisor = newSupervisor(func() (*exec.Cmd, error) {
+		return fn.command(w, port)
+	}, probe, fn.StartupTimeout, fn.RestartPolicy)
+	w.supervisor.logger = logging.Default().With(logging.KeyWorker, index)
+	return w, nil
+}
+
+// workerUpstream - URL and port of the worker with the given index, the first worker listens on the upstream URL
+func workerUpstream(upstreamURL string, index int) (string, int, error) {
+	upstream, err := url.Parse(upstreamURL)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(upstream.Port())
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid upstream port in %s", upstreamURL)
+	}
+
+	port += index
+	upstream.Host = net.JoinHostPort(upstream.Hostname(), strconv.Itoa(port))
+	return upstream.String(), port, nil
+}
+
+// checkWorkerPorts - fail if a reserved port is in the range of ports workers listen on, from the given port
+func (fn *FunctionInvoker) checkWorkerPorts(firstPort int) error {
+	workers := fn.MaxWorkers
+	if workers < fn.MinWorkers {
+		workers = fn.MinWorkers
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	lastPort := firstPort + workers - 1
+	for _, port := range fn.ReservedPorts {
+		if port >= firstPort && port <= lastPort {
+			return fmt.Errorf("port %d is used by the core runtime, it must not be one of the worker ports %d-%d", port, firstPort, lastPort)
+		}
+	}
+	return nil
+}
+
+// IsReady - whether a worker is running and ready to handle invocations
+func (fn *FunctionInvoker) IsReady() bool {
+	return fn.pool.available() != nil
+}
+
+// HasStarted - whether the sub-runtime has been ready at least once since the invoker started
+func (fn *FunctionInvoker) HasStarted() bool {
+	select {
+	case <-fn.pool.started:
+		return true
+	default:
+		return false
+	}
+}
+
+// ColdStartDuration - time it took for the first worker to become ready, zero until it is ready
+func (fn *FunctionInvoker) ColdStartDuration() time.Duration {
+	return time.Duration(atomic.LoadInt64(&fn.pool.coldStart))
+}
+
+// Ping - check that a worker is ready and still answering
+func (fn *FunctionInvoker) Ping(ctx context.Context) error {
+	w := fn.pool.available()
+	if w == nil {
+		return ErrorSubRuntimeNotReady
+	}
+	if fn.Protocol == ProtocolStdio {
+		return nil
+	}
+	return fn.probe(ctx, w)
+}
+
+// WaitReady - wait until a worker is ready to handle invocations, or until the given context is done
+func (fn *FunctionInvoker) WaitReady(ctx context.Context) error {
+	return fn.pool.ready(ctx)
+}
+
+// probe - check once whether a worker accepts connections, or answers on its health route if configured
+// Workers with a Unix socket are probed on it first, and over TCP if they do not listen on it
+func (fn *FunctionInvoker) probe(ctx context.Context, w *worker) error {
+	// Lambda runtimes are ready once they ask for their first invocation
+	if w.lambda != nil {
+		return w.lambda.ready()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	if w.socketPath != "" {
+		if err := fn.probeClient(ctx, w.socketClient, "unix", w.socketPath, w.upstreamURL); err == nil {
+			w.setOverSocket(true)
+			return nil
+		}
+	}
+
+	upstream, err := url.Parse(w.upstreamURL)
+	if err != nil {
+		return err
+	}
+	if err := fn.probeClient(ctx, w.tcpClient, "tcp", upstream.Host, w.upstreamURL); err != nil {
+		return err
+	}
+	w.setOverSocket(false)
+	return nil
+}
+
+// probeClient - check once whether the given address accepts connections, or whether the health route answers
+// through the given client if configured
+func (fn *FunctionInvoker) probeClient(ctx context.Context, client *http.Client, network, address, upstreamURL string) error {
+	if fn.HealthPath == "" {
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	request, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(upstreamURL, "/")+fn.HealthPath, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("sub-runtime health route answered with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// Stop - terminate the workers with SIGTERM, and with SIGKILL if they are still running after the given timeout
+func (fn *FunctionInvoker) Stop(timeout time.Duration) error {
+	terminated := fn.pool.terminate()
+
+	select {
+	case <-terminated:
+		return nil
+	case <-time.After(timeout):
+	}
+
+	fn.pool.kill()
+	<-terminated
+	return fmt.Errorf("sub-runtime did not terminate within %v, it has been killed", timeout)
+}
+
+// command - build the command to start the sub-runtime, with its output bound to the output of this process
+func (fn *FunctionInvoker) command(w *worker, port int) (*exec.Cmd, error) {
 	var cmd *exec.Cmd
 	// If Handler is a binary file, execute binary instead of bridge, and only pass event/context instead of full handler file/name
 	if fn.IsBinary {
@@ -75,102 +367,320 @@ func (fn *FunctionInvoker) Start() error {
 	} else {
 		cmd = exec.Command(fn.RuntimeBinary, fn.RuntimeBridge)
 	}
+	// Run sub-runtime in its own process group, so that signals sent to the core runtime (e.g. Ctrl+C) do not reach it
+	// directly: it is terminated by the core runtime once in-flight invocations are drained
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// Every worker listens on its own port, or on its own Unix socket if it supports it, with the configured protocol
+	cmd.Env = append(os.Environ(), fmt.Sprintf("SCW_UPSTREAM_PORT=%d", port), fmt.Sprintf("SCW_WORKER_ID=%d", w.index),
+		"SCW_RUNTIME_PROTOCOL="+fn.Protocol)
+	if w.socketPath != "" {
+		if err := prepareSocket(w.socketPath); err != nil {
+			return nil, err
+		}
+		cmd.Env = append(cmd.Env, "SCW_UPSTREAM_SOCKET="+w.socketPath)
+	}
+	if w.lambda != nil {
+		address, err := lambdaAddress(w.upstreamURL)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Env = append(cmd.Env, fn.lambdaEnvironment(address)...)
+		w.lambda.reset()
+	}
 
-	var (
-		stdoutPipe io.ReadCloser
-		stdinErr   error
-		stdoutErr  error
-	)
-
-	_, stdinErr = cmd.StdinPipe()
-	if stdinErr != nil {
-		return stdinErr
+	// Logs lines from stderr and stdout to the stderr and stdout of this process, with the stdio protocol
+	// stdout is reserved to responses
+	cmd.Stderr = newLoggingWriter("stderr", os.Stderr, fn.StderrLevel, w)
+	if fn.Protocol == ProtocolStdio {
+		conn, err := newFrameConn(cmd)
+		if err != nil {
+			return nil, err
+		}
+		w.setFrameConn(conn)
+		return cmd, nil
 	}
 
-	stdoutPipe, stdoutErr = cmd.StdoutPipe()
-	if stdoutErr != nil {
-		return stdoutErr
+	if _, err := cmd.StdinPipe(); err != nil {
+		return nil, err
 	}
+	cmd.Stdout = newLoggingWriter("stdout", os.Stdout, logging.LevelInfo, w)
+
+	return cmd, nil
+}
+
+// Done - channel closed once the sub-runtime is not supervised anymore, either because it was stopped
+// or because one of its workers crashed too many times
+func (fn *FunctionInvoker) Done() <-chan struct{} {
+	return fn.pool.done
+}
 
-	errPipe, _ := cmd.StderrPipe()
+// Err - reason why the sub-runtime is not supervised anymore, nil while it is still running
+func (fn *FunctionInvoker) Err() error {
+	return fn.pool.failure()
+}
 
-	// Logs lines from stderr and stdout to the stderr and stdout of this process
-	bindLoggingPipe("stderr", errPipe, os.Stderr)
-	bindLoggingPipe("stdout", stdoutPipe, os.Stdout)
+// CrashCount - number of times a worker terminated unexpectedly since the invoker started
+func (fn *FunctionInvoker) CrashCount() uint64 {
+	return fn.pool.crashes()
+}
 
-	go func() {
-		sig := make(chan os.Signal, 1)
-		signal.Notify(sig, syscall.SIGTERM)
+// RecycleCount - number of times a worker was replaced after too many invocations or too much memory growth
+func (fn *FunctionInvoker) RecycleCount() uint64 {
+	return atomic.LoadUint64(&fn.pool.recycles)
+}
+
+// WorkerCount - number of running workers, including starting ones
+func (fn *FunctionInvoker) WorkerCount() int {
+	return fn.pool.size()
+}
+
+// InFlightCount - number of invocations being executed
+func (fn *FunctionInvoker) InFlightCount() int {
+	return fn.pool.inFlight()
+}
 
-		<-sig
-		cmd.Process.Signal(syscall.SIGTERM)
+// QueueLength - number of invocations waiting for the concurrency limit to allow their execution
+func (fn *FunctionInvoker) QueueLength() int {
+	return fn.limiter.queueLength()
+}
+
+// Execute - a given function handler, and handle response
+// The invocation is cancelled when the given context is done, in particular when its deadline is exceeded
+// When MaxConcurrency invocations are already being executed, it waits in queue until one of them completes,
+// it is then sent to the least busy worker
+// Responses streamed by the handler are returned as a *StreamedResponse, see ResponseStreamContentType
+func (fn *FunctionInvoker) Execute(ctx context.Context, event interface{}, executionContext events.ExecutionContext) (io.ReadCloser, error) {
+	return fn.ExecuteStream(ctx, event, nil, executionContext)
+}
+
+type dispatchedKey struct{}
 
+// ContextWithDispatched - set a function called once an invocation executed with ctx acquired a concurrency slot
+// and a worker, right before it is sent to the sub-runtime, it is not called for rejected invocations
+func ContextWithDispatched(ctx context.Context, dispatched func()) context.Context {
+	return context.WithValue(ctx, dispatchedKey{}, dispatched)
+}
+
+// ExecuteStream - a given function handler, streaming the given body to the sub-runtime after the invocation
+// The sub-runtime receives a request of type StreamContentType: the JSON invocation on a single line,
+// followed by the raw body, nil bodies are sent as with Execute
+// The body is not read anymore once an error is returned, or once the returned response has been closed
+func (fn *FunctionInvoker) ExecuteStream(ctx context.Context, event interface{}, body io.Reader, executionContext events.ExecutionContext) (_ io.ReadCloser, err error) {
+	ctx, span := tracing.Start(ctx, "invoke handler", tracing.SpanKindClient)
+	span.SetAttribute("faas.invocation_id", executionContext.InvocationID)
+	defer func() {
+		span.SetError(err)
+		span.End()
 	}()
 
-	err := cmd.Start()
-	go func() {
-		err := cmd.Wait()
+	// Concurrency slot, worker and invocation are held until its response has been read
+	release, err := fn.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w, p, err := fn.acquireWorker(ctx)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	span.SetAttribute("faas.worker", w.index)
+	if dispatched, ok := ctx.Value(dispatchedKey{}).(func()); ok {
+		dispatched()
+	}
+	untrack := w.invocations.start(executionContext.InvocationID)
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			untrack()
+			fn.pool.release(w, p)
+			release()
+		})
+	}
+	defer func() {
 		if err != nil {
-			log.Fatalf("Forked function has terminated: %s", err.Error())
+			done()
 		}
 	}()
 
-	return err
-}
-
-// Execute - a given function handler, and handle response
-func (fn *FunctionInvoker) Execute(event interface{}, context events.ExecutionContext) (io.ReadCloser, error) {
 	reqBody := CoreRuntimeRequest{
-		Event:       event,
-		Context:     context,
-		HandlerName: fn.HandlerName,
-		HandlerPath: fn.HandlerFilePath,
+		Event:        event,
+		Context:      executionContext,
+		HandlerName:  fn.HandlerName,
+		HandlerPath:  fn.HandlerFilePath,
+		TraceContext: tracing.Carrier(span.Context),
 	}
 
-	res, err := fn.streamRequest(reqBody)
+	res, err := fn.streamRequest(ctx, w, p, reqBody, body)
 	if err != nil {
 		return nil, err
 	}
+	span.SetAttribute("http.status_code", res.StatusCode)
 
 	// If an error occured in sub-runtime
 	if res.StatusCode == http.StatusInternalServerError {
+		defer res.Body.Close()
 		responseBody, err := ioutil.ReadAll(res.Body)
 		if err != nil {
-			log.Printf("Read response body error, %v", err)
-			return nil, err
+			logging.Errorf("Read response body error, %v", err)
+			return nil, contextError(ctx, err)
 		}
 		// Error message is the response body
 		return nil, handlerExecutionError(string(responseBody))
 	}
 
-	return res.Body, nil
+	responseBody := &onClose{ReadCloser: res.Body, close: done}
+	// Handlers may stream their response, its status code and headers are then sent before its body
+	if res.Header.Get("Content-Type") == ResponseStreamContentType {
+		streamed, err := newStreamedResponse(responseBody)
+		if err != nil {
+			responseBody.Close()
+			return nil, contextError(ctx, err)
+		}
+		return streamed, nil
+	}
+	return responseBody, nil
+}
+
+// acquireWorker - reserve a worker for an invocation, on cold-start or after a crash workers may still be
+// starting-up, wait until one of them is ready
+func (fn *FunctionInvoker) acquireWorker(ctx context.Context) (*worker, *process, error) {
+	readyCtx, cancelReady := context.WithTimeout(ctx, fn.StartupTimeout)
+	defer cancelReady()
+
+	w, p, err := fn.pool.acquire(readyCtx)
+	if err == context.DeadlineExceeded && ctx.Err() == nil {
+		return nil, nil, ErrorSubRuntimeNotReady
+	} else if err != nil {
+		return nil, nil, contextError(ctx, err)
+	}
+	return w, p, nil
 }
 
-func (fn FunctionInvoker) streamRequest(reqBody CoreRuntimeRequest) (res *http.Response, err error) {
+func (fn *FunctionInvoker) streamRequest(ctx context.Context, w *worker, p *process, reqBody CoreRuntimeRequest, body io.Reader) (*http.Response, error) {
+	if body != nil && fn.Protocol != ProtocolHTTP {
+		return nil, ErrorStreamingNotSupported
+	}
+	if w.lambda != nil {
+		res, err := w.lambda.invoke(ctx, p, reqBody)
+		if err != nil && w.lambda.isBusy() {
+			logging.Warnf("Recycling worker %d, its Lambda runtime is still handling an invocation which timed out", w.index)
+			fn.pool.recycleNow(w, p, recycleTimeout)
+		}
+		return res, err
+	}
 	bodyJSON, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, err
 	}
-	body := bytes.NewReader(bodyJSON)
-	request, _ := http.NewRequest("POST", fn.upstreamURL, body)
-	request.Header.Set("Content-Type", "application/json")
+	if fn.Protocol == ProtocolStdio {
+		return fn.invokeFramed(ctx, w, p, bodyJSON)
+	}
 
-	// Try again, if cold-start, sub-runtime may still be starting-up, try for next 10 seconds, or until it responds properly
-	done := false
-	retries := 0
-	for !done && retries < 200 {
-		res, err = fn.client.Do(request)
-		if err != nil {
-			time.Sleep(retryInterval)
-			retries++
-			continue
-		}
-		done = true
+	var request *http.Request
+	// Streamed bodies may still be read by the transport once the response has been received, or the request aborted
+	streamed := newSentBody(body)
+	if body != nil {
+		// JSON encoding escapes line breaks, the invocation is the first line of the request
+		streamed.Reader = io.MultiReader(bytes.NewReader(bodyJSON), strings.NewReader("\n"), body)
+		request, _ = http.NewRequest("POST", w.upstreamURL, streamed)
+		request.Header.Set("Content-Type", StreamContentType)
+	} else {
+		request, _ = http.NewRequest("POST", w.upstreamURL, bytes.NewReader(bodyJSON))
+		request.Header.Set("Content-Type", "application/json")
 	}
+	tracing.Inject(tracing.SpanContextFromContext(ctx), request.Header)
 
-	// An error occured
-	if !done {
-		return nil, fmt.Errorf("too many retries, sub-runtime server did not come up in %v seconds", retryInterval/1000*200)
+	requestCtx, cancel := processContext(ctx, p)
+	// Aborting the request stops the transport from writing it, the body is not read anymore once it is released
+	release := func() {
+		cancel()
+		streamed.wait()
+	}
+	res, err := w.client().Do(request.WithContext(requestCtx))
+	if err != nil {
+		release()
+		return nil, requestError(ctx, p, err)
 	}
-	return
+
+	// Keep the request context alive until the response body has been read
+	res.Body = &onClose{ReadCloser: res.Body, close: release}
+	return res, nil
+}
+
+// sentBody - body of a request, closed by the transport once it is done writing it, even on errors
+// The transport writes bodies asynchronously, waiting for it ensures they are not read anymore, e.g. once the
+// HTTP handler streaming its request body has returned
+type sentBody struct {
+	io.Reader
+	once   sync.Once
+	closed chan struct{}
+}
+
+// newSentBody - wrap the given body, nil bodies are never sent thus never waited for
+func newSentBody(body io.Reader) *sentBody {
+	b := &sentBody{closed: make(chan struct{})}
+	if body == nil {
+		close(b.closed)
+	}
+	return b
+}
+
+func (b *sentBody) Close() error {
+	b.once.Do(func() {
+		close(b.closed)
+	})
+	return nil
+}
+
+// wait - until the transport is done writing the body
+func (b *sentBody) wait() {
+	<-b.closed
+}
+
+// requestError - error of an invocation which did not receive a response from the given process
+func requestError(ctx context.Context, p *process, err error) error {
+	if ctx.Err() != nil {
+		return contextError(ctx, err)
+	}
+	// Sub-runtime terminated while handling this request, give it a moment to be reaped
+	select {
+	case <-p.exited:
+		return ErrorSubRuntimeCrashed
+	case <-time.After(probeInterval):
+		return fmt.Errorf("unable to reach sub-runtime: %v", err)
+	}
+}
+
+// processContext - derive a context from the invocation context, which is also cancelled when the given
+// sub-runtime process exits, so that requests in-flight on this process are aborted
+func processContext(ctx context.Context, p *process) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-p.exited:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// contextError - return ErrorExecutionTimeout if the invocation failed because its deadline was exceeded
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrorExecutionTimeout
+	}
+	return err
+}
+
+// onClose - response body calling the given function once closed, e.g. to release the context of its request
+type onClose struct {
+	io.ReadCloser
+	close func()
+}
+
+func (body *onClose) Close() error {
+	err := body.ReadCloser.Close()
+	body.close()
+	return err
 }
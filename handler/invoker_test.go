@@ -0,0 +1,357 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/scaleway/functions-runtime/events"
+)
+
+// newTestInvoker - invoker running the given shell script as sub-runtime, invocations are sent to upstreamURL
+func newTestInvoker(t *testing.T, dir, script, upstreamURL string) *FunctionInvoker {
+	bridge := filepath.Join(dir, "bridge.sh")
+	if err := ioutil.WriteFile(bridge, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fn, err := NewInvoker("sh", bridge, "", "handler", upstreamURL, false)
+	if err != nil {
+		t.Fatalf("NewInvoker(), received error %v", err)
+	}
+	fn.RestartPolicy = fixtureRestartPolicy
+	fn.StartupTimeout = 5 * time.Second
+	return fn
+}
+
+func TestInvokerStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scw-invoker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Sub-runtime is ready as soon as the upstream accepts connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	t.Run("kills the sub-runtime when it ignores SIGTERM", func(t *testing.T) {
+		trapped := filepath.Join(dir, "trapped")
+		fn := newTestInvoker(t, dir, "trap '' TERM; touch "+trapped+"; exec sleep 10", "http://"+listener.Addr().String())
+		if err := fn.Start(); err != nil {
+			t.Fatalf("Start(), received error %v", err)
+		}
+		if err := fn.WaitReady(context.Background()); err != nil {
+			t.Fatalf("WaitReady(), received error %v", err)
+		}
+		waitFile(t, trapped)
+		p := fn.pool.available().supervisor.running()
+
+		if err := fn.Stop(50 * time.Millisecond); err == nil {
+			t.Error("Stop(), expected an error as the sub-runtime had to be killed")
+		}
+		if status, ok := p.cmd.ProcessState.Sys().(syscall.WaitStatus); !ok || status.Signal() != syscall.SIGKILL {
+			t.Errorf("sub-runtime terminated with %v, expected to be killed", p.err)
+		}
+		if fn.Err() != ErrorSubRuntimeStopped {
+			t.Errorf("Err() = %v, expected %v", fn.Err(), ErrorSubRuntimeStopped)
+		}
+	})
+
+	t.Run("terminates the sub-runtime with SIGTERM", func(t *testing.T) {
+		fn := newTestInvoker(t, dir, "exec sleep 10", "http://"+listener.Addr().String())
+		if err := fn.Start(); err != nil {
+			t.Fatalf("Start(), received error %v", err)
+		}
+		if err := fn.WaitReady(context.Background()); err != nil {
+			t.Fatalf("WaitReady(), received error %v", err)
+		}
+
+		if err := fn.Stop(5 * time.Second); err != nil {
+			t.Errorf("Stop(), received error %v", err)
+		}
+		select {
+		case <-fn.Done():
+		default:
+			t.Error("Done() should be closed once the sub-runtime is stopped")
+		}
+	})
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	received := make(chan CoreRuntimeRequest, 1)
+	cancelled := make(chan struct{})
+	// Handler never answers, its request is only aborted by the core runtime
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request CoreRuntimeRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		received <- request
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	defer upstream.Close()
+
+	dir, err := ioutil.TempDir("", "scw-invoker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := newTestInvoker(t, dir, "exec sleep 10", upstream.URL)
+	if err := fn.Start(); err != nil {
+		t.Fatalf("Start(), received error %v", err)
+	}
+	defer fn.Stop(5 * time.Second)
+	if err := fn.WaitReady(context.Background()); err != nil {
+		t.Fatalf("WaitReady(), received error %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	executionContext := events.GetExecutionContext().WithDeadline(deadline)
+
+	if _, err := fn.Execute(ctx, map[string]interface{}{}, executionContext); err != ErrorExecutionTimeout {
+		t.Errorf("Execute(), received error %v, expected %v", err, ErrorExecutionTimeout)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request to the sub-runtime was not cancelled")
+	}
+	if request := <-received; request.Context.Deadline != deadline.UnixNano()/int64(time.Millisecond) {
+		t.Errorf("deadline = %d, expected %d", request.Context.Deadline, deadline.UnixNano()/int64(time.Millisecond))
+	}
+	if inFlight := fn.InFlightCount(); inFlight != 0 {
+		t.Errorf("InFlightCount() = %d, expected the timed out invocation to be released", inFlight)
+	}
+}
+
+func TestInvokerReadiness(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scw-invoker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("probes the health route until it succeeds", func(t *testing.T) {
+		var healthy int32
+		paths := make(chan string, 100)
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case paths <- r.URL.Path:
+			default:
+			}
+			if atomic.LoadInt32(&healthy) == 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer upstream.Close()
+
+		fn := newTestInvoker(t, dir, "exec sleep 10", upstream.URL)
+		fn.HealthPath = "/health"
+		if err := fn.Start(); err != nil {
+			t.Fatalf("Start(), received error %v", err)
+		}
+		defer fn.Stop(5 * time.Second)
+
+		// Workers answering with an error are not ready, even though they accept connections
+		for i := 0; i < 2; i++ {
+			if path := <-paths; path != "/health" {
+				t.Errorf("probed %s, expected /health", path)
+			}
+		}
+		if fn.IsReady() {
+			t.Error("IsReady() = true, expected the unhealthy worker not to be ready")
+		}
+
+		atomic.StoreInt32(&healthy, 1)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := fn.WaitReady(ctx); err != nil {
+			t.Fatalf("WaitReady(), received error %v", err)
+		}
+	})
+
+	t.Run("invocations wait for readiness until the startup timeout", func(t *testing.T) {
+		// Nothing listens on the upstream, the sub-runtime never becomes ready
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listener.Close()
+
+		fn := newTestInvoker(t, dir, "exec sleep 10", "http://"+listener.Addr().String())
+		fn.StartupTimeout = 200 * time.Millisecond
+		// Never give up restarting it, so that invocations only fail because it is not ready
+		fn.RestartPolicy = RestartPolicy{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, CrashWindow: time.Minute}
+		if err := fn.Start(); err != nil {
+			t.Fatalf("Start(), received error %v", err)
+		}
+		defer fn.Stop(5 * time.Second)
+
+		start := time.Now()
+		if _, err := fn.Execute(context.Background(), map[string]interface{}{}, events.GetExecutionContext()); err != ErrorSubRuntimeNotReady {
+			t.Errorf("Execute(), received error %v, expected %v", err, ErrorSubRuntimeNotReady)
+		}
+		if waited := time.Since(start); waited < fn.StartupTimeout {
+			t.Errorf("invocation failed after %v, expected it to wait for %v", waited, fn.StartupTimeout)
+		}
+	})
+}
+
+// slowBody - endless request body, sent slowly as by a client uploading it
+type slowBody struct {
+	reads  int32
+	active int32
+}
+
+func (b *slowBody) Read(p []byte) (int, error) {
+	atomic.AddInt32(&b.reads, 1)
+	atomic.AddInt32(&b.active, 1)
+	defer atomic.AddInt32(&b.active, -1)
+	time.Sleep(50 * time.Millisecond)
+	return len(p), nil
+}
+
+func TestExecuteStreamAborted(t *testing.T) {
+	// Sub-runtime answers, or times out, without reading the streamed body
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("hang") != "" {
+			io.Copy(ioutil.Discard, r.Body)
+			return
+		}
+		io.WriteString(w, `{"statusCode": 200}`)
+		w.(http.Flusher).Flush()
+	}))
+	defer upstream.Close()
+
+	dir, err := ioutil.TempDir("", "scw-invoker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// assertNotRead - body must not be read anymore, e.g. by the transport still writing the request
+	assertNotRead := func(t *testing.T, body *slowBody) {
+		if atomic.LoadInt32(&body.active) != 0 {
+			t.Error("body is still being read once the invocation completed")
+		}
+		reads := atomic.LoadInt32(&body.reads)
+		time.Sleep(100 * time.Millisecond)
+		if after := atomic.LoadInt32(&body.reads); after != reads {
+			t.Errorf("body was read %d times once the invocation completed", after-reads)
+		}
+	}
+
+	tests := []struct {
+		query   string
+		timeout time.Duration
+	}{
+		{"", 5 * time.Second},
+		{"?hang=true", 100 * time.Millisecond},
+	}
+	for _, test := range tests {
+		query := test.query
+		fn := newTestInvoker(t, dir, "exec sleep 10", upstream.URL+query)
+		if err := fn.Start(); err != nil {
+			t.Fatalf("Start(), received error %v", err)
+		}
+		defer fn.Stop(5 * time.Second)
+		if err := fn.WaitReady(context.Background()); err != nil {
+			t.Fatalf("WaitReady(), received error %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), test.timeout)
+		defer cancel()
+		body := &slowBody{}
+		res, err := fn.ExecuteStream(ctx, map[string]interface{}{}, body, events.GetExecutionContext())
+		if query == "" {
+			if err != nil {
+				t.Fatalf("ExecuteStream(), received error %v", err)
+			}
+			res.Close()
+		} else if err != ErrorExecutionTimeout {
+			t.Errorf("ExecuteStream(), received error %v, expected %v", err, ErrorExecutionTimeout)
+		}
+		assertNotRead(t, body)
+	}
+}
+
+func TestExecuteStdioTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scw-invoker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// First process never answers, the processes replacing it send invocation frames back as they are
+	hung := filepath.Join(dir, "hung")
+	fn := newTestInvoker(t, dir, "if [ -e "+hung+" ]; then exec cat; fi; touch "+hung+"; exec sleep 10", "http://127.0.0.1:8081")
+	fn.Protocol = ProtocolStdio
+	if err := fn.Start(); err != nil {
+		t.Fatalf("Start(), received error %v", err)
+	}
+	defer fn.Stop(5 * time.Second)
+	if err := fn.WaitReady(context.Background()); err != nil {
+		t.Fatalf("WaitReady(), received error %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := fn.Execute(ctx, map[string]interface{}{}, events.GetExecutionContext()); err != ErrorExecutionTimeout {
+		t.Fatalf("Execute(), received error %v, expected %v", err, ErrorExecutionTimeout)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := fn.Execute(ctx, map[string]interface{}{}, events.GetExecutionContext())
+	if err != nil {
+		t.Fatalf("Execute(), received error %v, expected the hung process to be replaced", err)
+	}
+	res.Close()
+}
+
+func TestCheckWorkerPorts(t *testing.T) {
+	tests := []struct {
+		minWorkers    int
+		maxWorkers    int
+		reservedPorts []int
+		expectErr     bool
+	}{
+		{1, 1, []int{8080}, false},
+		{1, 1, []int{8081}, true},
+		{1, 4, []int{8080, 8085}, false},
+		{1, 4, []int{8080, 8084}, true},
+		{3, 1, []int{8083}, true},
+	}
+
+	for _, test := range tests {
+		fn := &FunctionInvoker{MinWorkers: test.minWorkers, MaxWorkers: test.maxWorkers, ReservedPorts: test.reservedPorts}
+		if err := fn.checkWorkerPorts(8081); (err != nil) != test.expectErr {
+			t.Errorf("checkWorkerPorts() with %d-%d workers and ports %v, received error %v", test.minWorkers, test.maxWorkers, test.reservedPorts, err)
+		}
+	}
+}
+
+func TestInvokerStart_invalidStartupTimeout(t *testing.T) {
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		fn, _ := NewInvoker("sleep", "10", "", "handler", "http://127.0.0.1:8081", false)
+		fn.StartupTimeout = timeout
+		if err := fn.Start(); err == nil {
+			fn.Stop(5 * time.Second)
+			t.Errorf("Start() with a startup timeout of %v, expected an error", timeout)
+		}
+	}
+}
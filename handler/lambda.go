@@ -0,0 +1,278 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/scaleway/functions-runtime/events"
+	"github.com/scaleway/functions-runtime/logging"
+)
+
+const (
+	// lambdaAPIPrefix - path prefix of the AWS Lambda Runtime API
+	lambdaAPIPrefix = "/2018-06-01/runtime/"
+	// lambdaFunctionARN - format of the ARN given to Lambda runtimes, some of them expect one to be set
+	lambdaFunctionARN = "arn:aws:lambda:scw:000000000000:function:%s"
+)
+
+// lambdaInvocation - invocation waiting to be fetched, and answered, by a Lambda runtime
+type lambdaInvocation struct {
+	id       string
+	deadline int64
+	event    []byte
+	response chan lambdaResponse
+}
+
+type lambdaResponse struct {
+	status int
+	body   []byte
+}
+
+// lambdaError - error reported by Lambda runtimes, see https://docs.aws.amazon.com/lambda/latest/dg/runtimes-api.html
+type lambdaError struct {
+	ErrorMessage string `json:"errorMessage"`
+	ErrorType    string `json:"errorType"`
+}
+
+// lambdaRuntimeAPI - AWS Lambda Runtime API served to the process of a worker, for Lambda runtimes to run unmodified
+type lambdaRuntimeAPI struct {
+	// polled is accessed atomically, 1 once the running process asked for an invocation
+	polled int32
+	// nextID is accessed atomically, invocation IDs come from callers and may not be unique nor valid in paths
+	nextID uint64
+
+	address     string
+	server      *http.Server
+	invocations chan *lambdaInvocation
+	// onInitError is called when the running process reports that it failed to initialize
+	onInitError func(message string)
+
+	mu      sync.Mutex
+	pending map[string]*lambdaInvocation
+	// expired invocations were not answered in time, their late responses are still accepted and discarded, as
+	// Lambda runtimes exit when a response is rejected
+	expired map[string]bool
+}
+
+// newLambdaRuntimeAPI - serve the Lambda Runtime API on the given address (host:port)
+func newLambdaRuntimeAPI(address string, onInitError func(message string)) (*lambdaRuntimeAPI, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	api := &lambdaRuntimeAPI{
+		address:     listener.Addr().String(),
+		invocations: make(chan *lambdaInvocation),
+		onInitError: onInitError,
+		pending:     map[string]*lambdaInvocation{},
+		expired:     map[string]bool{},
+	}
+	api.server = &http.Server{Handler: http.HandlerFunc(api.serveHTTP)}
+	go api.server.Serve(listener)
+	return api, nil
+}
+
+func (api *lambdaRuntimeAPI) close() {
+	api.server.Close()
+}
+
+// reset - forget the polls and expired invocations of the previous process, before a new one is started
+func (api *lambdaRuntimeAPI) reset() {
+	atomic.StoreInt32(&api.polled, 0)
+	api.mu.Lock()
+	api.expired = map[string]bool{}
+	api.mu.Unlock()
+}
+
+// isBusy - whether the runtime is still handling an expired invocation, and will not fetch the next ones
+func (api *lambdaRuntimeAPI) isBusy() bool {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return len(api.expired) > 0
+}
+
+// ready - a Lambda runtime is ready as soon as it asks for its first invocation
+func (api *lambdaRuntimeAPI) ready() error {
+	if atomic.LoadInt32(&api.polled) == 0 {
+		return ErrorSubRuntimeNotReady
+	}
+	return nil
+}
+
+func (api *lambdaRuntimeAPI) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, lambdaAPIPrefix)
+	switch {
+	case r.Method == http.MethodGet && path == "invocation/next":
+		api.next(w, r)
+	case r.Method == http.MethodPost && path == "init/error":
+		body, _ := ioutil.ReadAll(r.Body)
+		message := lambdaErrorMessage(body)
+		logging.Errorf("Lambda runtime failed to initialize: %s", message)
+		api.onInitError(message)
+		writeLambdaAccepted(w)
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "invocation/"):
+		parts := strings.Split(strings.TrimPrefix(path, "invocation/"), "/")
+		if len(parts) != 2 || (parts[1] != "response" && parts[1] != "error") {
+			http.NotFound(w, r)
+			return
+		}
+		api.respond(w, r, parts[0], parts[1] == "error")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// next - hand the next invocation over to the Lambda runtime, once there is one
+func (api *lambdaRuntimeAPI) next(w http.ResponseWriter, r *http.Request) {
+	atomic.StoreInt32(&api.polled, 1)
+
+	select {
+	case invocation := <-api.invocations:
+		w.Header().Set("Lambda-Runtime-Aws-Request-Id", invocation.id)
+		w.Header().Set("Lambda-Runtime-Deadline-Ms", strconv.FormatInt(invocation.deadline, 10))
+		w.Header().Set("Lambda-Runtime-Invoked-Function-Arn", fmt.Sprintf(lambdaFunctionARN, events.GetExecutionContext().FunctionName))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(invocation.event)
+	case <-r.Context().Done():
+	}
+}
+
+// respond - pass the response, or the error, reported by the Lambda runtime to the pending invocation
+func (api *lambdaRuntimeAPI) respond(w http.ResponseWriter, r *http.Request, id string, failed bool) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	api.mu.Lock()
+	invocation, ok := api.pending[id]
+	delete(api.pending, id)
+	expired := api.expired[id]
+	delete(api.expired, id)
+	api.mu.Unlock()
+	if expired {
+		logging.Warnf("Discarding response of Lambda invocation %s, received after its deadline", id)
+		writeLambdaAccepted(w)
+		return
+	} else if !ok {
+		http.Error(w, "unknown invocation "+id, http.StatusBadRequest)
+		return
+	}
+
+	if failed {
+		invocation.response <- lambdaResponse{status: http.StatusInternalServerError, body: []byte(lambdaErrorMessage(body))}
+	} else {
+		invocation.response <- lambdaResponse{status: http.StatusOK, body: body}
+	}
+	writeLambdaAccepted(w)
+}
+
+// invoke - hand the given request over to the Lambda runtime of the given process, and wait for its response
+func (api *lambdaRuntimeAPI) invoke(ctx context.Context, p *process, request CoreRuntimeRequest) (*http.Response, error) {
+	event, err := lambdaEvent(request.Event)
+	if err != nil {
+		return nil, err
+	}
+
+	invocation := &lambdaInvocation{
+		id:       strconv.FormatUint(atomic.AddUint64(&api.nextID, 1), 10),
+		deadline: request.Context.Deadline,
+		event:    event,
+		response: make(chan lambdaResponse, 1),
+	}
+
+	api.mu.Lock()
+	api.pending[invocation.id] = invocation
+	api.mu.Unlock()
+	defer func() {
+		api.mu.Lock()
+		delete(api.pending, invocation.id)
+		api.mu.Unlock()
+	}()
+
+	requestCtx, cancel := processContext(ctx, p)
+	defer cancel()
+
+	select {
+	case api.invocations <- invocation:
+	case <-requestCtx.Done():
+		return nil, requestError(ctx, p, requestCtx.Err())
+	}
+
+	select {
+	case response := <-invocation.response:
+		return &http.Response{
+			StatusCode: response.status,
+			Body:       ioutil.NopCloser(bytes.NewReader(response.body)),
+		}, nil
+	case <-requestCtx.Done():
+		// The runtime is still handling the invocation, unless it answered meanwhile
+		api.mu.Lock()
+		if _, ok := api.pending[invocation.id]; ok {
+			api.expired[invocation.id] = true
+		}
+		api.mu.Unlock()
+		return nil, requestError(ctx, p, requestCtx.Err())
+	}
+}
+
+// lambdaEvent - JSON document given to Lambda handlers, JSON events of non-HTTP triggers are passed as objects
+func lambdaEvent(event interface{}) ([]byte, error) {
+	if raw, ok := event.(string); ok && json.Valid([]byte(raw)) {
+		return []byte(raw), nil
+	}
+	return json.Marshal(event)
+}
+
+// lambdaErrorMessage - message of an error reported by a Lambda runtime, which should be a JSON object but may not be
+func lambdaErrorMessage(body []byte) string {
+	var lambdaErr lambdaError
+	if err := json.Unmarshal(body, &lambdaErr); err != nil || lambdaErr.ErrorMessage == "" {
+		return string(body)
+	}
+	if lambdaErr.ErrorType != "" {
+		return lambdaErr.ErrorType + ": " + lambdaErr.ErrorMessage
+	}
+	return lambdaErr.ErrorMessage
+}
+
+func writeLambdaAccepted(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"status":"OK"}`))
+}
+
+// lambdaEnvironment - environment variables expected by Lambda runtimes, which reach the Runtime API on the given address
+func (fn *FunctionInvoker) lambdaEnvironment(address string) []string {
+	executionContext := events.GetExecutionContext()
+	return []string{
+		"AWS_LAMBDA_RUNTIME_API=" + address,
+		"AWS_LAMBDA_FUNCTION_NAME=" + executionContext.FunctionName,
+		"AWS_LAMBDA_FUNCTION_VERSION=" + executionContext.FunctionVersion,
+		"AWS_LAMBDA_FUNCTION_MEMORY_SIZE=" + strconv.Itoa(executionContext.MemoryLimitInMB),
+		"LAMBDA_TASK_ROOT=" + filepath.Dir(fn.HandlerFilePath),
+		"_HANDLER=" + fn.HandlerName,
+	}
+}
+
+// lambdaAddress - address the Lambda Runtime API of a worker is served on, its upstream host and port
+func lambdaAddress(upstreamURL string) (string, error) {
+	upstream, err := url.Parse(upstreamURL)
+	if err != nil {
+		return "", err
+	}
+	return upstream.Host, nil
+}
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scaleway/functions-runtime/events"
+)
+
+// lambdaRuntime - fetch the next invocation from the given Runtime API, and post the given response, or error, to it
+func lambdaRuntime(t *testing.T, api *lambdaRuntimeAPI, result, body string) <-chan string {
+	received := make(chan string, 1)
+	go func() {
+		res, err := http.Get("http://" + api.address + lambdaAPIPrefix + "invocation/next")
+		if err != nil {
+			t.Errorf("next, received error %v", err)
+			return
+		}
+		event, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		received <- string(event)
+
+		id := res.Header.Get("Lambda-Runtime-Aws-Request-Id")
+		res, err = http.Post("http://"+api.address+lambdaAPIPrefix+"invocation/"+id+"/"+result, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Errorf("%s, received error %v", result, err)
+			return
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusAccepted {
+			t.Errorf("%s, received status %d, expected %d", result, res.StatusCode, http.StatusAccepted)
+		}
+	}()
+	return received
+}
+
+func TestLambdaRuntimeAPI(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	api, err := newLambdaRuntimeAPI("127.0.0.1:0", func(string) {})
+	if err != nil {
+		t.Fatalf("newLambdaRuntimeAPI(), received error %v", err)
+	}
+	defer api.close()
+	p := &process{cmd: exec.Command("true"), ready: make(chan struct{}), exited: make(chan struct{})}
+
+	if api.ready() == nil {
+		t.Error("ready(), expected an error before the runtime asked for an invocation")
+	}
+
+	tests := []struct {
+		name           string
+		event          interface{}
+		result         string
+		body           string
+		expectedEvent  string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"http event", events.APIGatewayProxyRequest{HTTPMethod: "GET", Body: "hello"}, "response", `{"statusCode":201}`,
+			`"httpMethod":"GET"`, http.StatusOK, `{"statusCode":201}`},
+		{"json event", `{"key":"value"}`, "response", `"done"`, `{"key":"value"}`, http.StatusOK, `"done"`},
+		{"text event", "hello", "response", `"done"`, `"hello"`, http.StatusOK, `"done"`},
+		{"error", "hello", "error", `{"errorMessage":"failed","errorType":"Error"}`, `"hello"`,
+			http.StatusInternalServerError, "Error: failed"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			received := lambdaRuntime(t, api, test.result, test.body)
+			res, err := api.invoke(ctx, p, CoreRuntimeRequest{Event: test.event})
+			if err != nil {
+				t.Fatalf("invoke(), received error %v", err)
+			}
+			body, _ := ioutil.ReadAll(res.Body)
+
+			if event := <-received; !strings.Contains(event, test.expectedEvent) {
+				t.Errorf("next = %s, expected it to contain %s", event, test.expectedEvent)
+			}
+			if res.StatusCode != test.expectedStatus || string(body) != test.expectedBody {
+				t.Errorf("invoke() = %d %s, expected %d %s", res.StatusCode, body, test.expectedStatus, test.expectedBody)
+			}
+		})
+	}
+
+	if err := api.ready(); err != nil {
+		t.Errorf("ready(), received error %v once the runtime asked for an invocation", err)
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		if _, err := api.invoke(timeoutCtx, p, CoreRuntimeRequest{Event: "hello"}); err != ErrorExecutionTimeout {
+			t.Errorf("invoke(), received error %v, expected %v", err, ErrorExecutionTimeout)
+		}
+	})
+
+	t.Run("late response", func(t *testing.T) {
+		fetched := make(chan string, 1)
+		go func() {
+			res, err := http.Get("http://" + api.address + lambdaAPIPrefix + "invocation/next")
+			if err != nil {
+				t.Errorf("next, received error %v", err)
+				return
+			}
+			res.Body.Close()
+			fetched <- res.Header.Get("Lambda-Runtime-Aws-Request-Id")
+		}()
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		if _, err := api.invoke(timeoutCtx, p, CoreRuntimeRequest{Event: "hello"}); err != ErrorExecutionTimeout {
+			t.Errorf("invoke(), received error %v, expected %v", err, ErrorExecutionTimeout)
+		}
+		if !api.isBusy() {
+			t.Error("isBusy() = false, expected the runtime to still handle the expired invocation")
+		}
+
+		// Lambda runtimes exit when their response is rejected
+		res, err := http.Post("http://"+api.address+lambdaAPIPrefix+"invocation/"+<-fetched+"/response", "application/json", strings.NewReader(`"late"`))
+		if err != nil {
+			t.Fatalf("response, received error %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusAccepted {
+			t.Errorf("response, received status %d, expected %d", res.StatusCode, http.StatusAccepted)
+		}
+		if api.isBusy() {
+			t.Error("isBusy() = true, expected the late response to complete the expired invocation")
+		}
+	})
+
+	t.Run("concurrent invocations with the same invocation ID", func(t *testing.T) {
+		// Invocation IDs come from callers, which may reuse them or use characters which are not valid in paths
+		first := lambdaRuntime(t, api, "response", `"first"`)
+		second := lambdaRuntime(t, api, "response", `"second"`)
+
+		bodies := make(chan string, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				res, err := api.invoke(ctx, p, CoreRuntimeRequest{Event: "hello", Context: events.ExecutionContext{InvocationID: "a/b?c#d%"}})
+				if err != nil {
+					t.Errorf("invoke(), received error %v", err)
+					bodies <- ""
+					return
+				}
+				body, _ := ioutil.ReadAll(res.Body)
+				bodies <- string(body)
+			}()
+		}
+		<-first
+		<-second
+
+		received := map[string]bool{<-bodies: true, <-bodies: true}
+		if !received[`"first"`] || !received[`"second"`] {
+			t.Errorf("invoke() responses = %v, expected both responses", received)
+		}
+	})
+
+	t.Run("unknown invocation", func(t *testing.T) {
+		res, err := http.Post("http://"+api.address+lambdaAPIPrefix+"invocation/unknown/response", "application/json", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("response, received error %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("response, received status %d, expected %d", res.StatusCode, http.StatusBadRequest)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter - bounds the number of concurrent invocations, invocations above the limit wait in a bounded queue
+// for a slot to be released, in their order of arrival
+type limiter struct {
+	slots        chan struct{}
+	maxQueueSize int
+	queueTimeout time.Duration
+
+	mu     sync.Mutex
+	queued int
+}
+
+// newLimiter - a limiter allowing maxConcurrency invocations at once, nil (no limit) if maxConcurrency is not positive
+func newLimiter(maxConcurrency, maxQueueSize int, queueTimeout time.Duration) *limiter {
+	if maxConcurrency <= 0 {
+		return nil
+	}
+	return &limiter{
+		slots:        make(chan struct{}, maxConcurrency),
+		maxQueueSize: maxQueueSize,
+		queueTimeout: queueTimeout,
+	}
+}
+
+// acquire a slot for an invocation, waiting in queue if none is available, the returned function releases the slot
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.releaseOnce(), nil
+	default:
+	}
+
+	l.mu.Lock()
+	if l.queued >= l.maxQueueSize {
+		l.mu.Unlock()
+		return nil, ErrorTooManyInvocations
+	}
+	l.queued++
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		l.queued--
+		l.mu.Unlock()
+	}()
+
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.releaseOnce(), nil
+	case <-timeout:
+		return nil, ErrorQueueTimeout
+	case <-ctx.Done():
+		return nil, contextError(ctx, ctx.Err())
+	}
+}
+
+// releaseOnce - function releasing a slot, which can safely be called several times
+func (l *limiter) releaseOnce() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-l.slots
+		})
+	}
+}
+
+// queueLength - number of invocations waiting for a slot
+func (l *limiter) queueLength() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.queued
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Run("no limit", func(t *testing.T) {
+		l := newLimiter(0, 0, 0)
+		for i := 0; i < 10; i++ {
+			if _, err := l.acquire(context.Background()); err != nil {
+				t.Fatalf("acquire(), received error %v", err)
+			}
+		}
+	})
+
+	t.Run("rejects invocations when queue is full", func(t *testing.T) {
+		l := newLimiter(1, 0, time.Second)
+		if _, err := l.acquire(context.Background()); err != nil {
+			t.Fatalf("acquire(), received error %v", err)
+		}
+		if _, err := l.acquire(context.Background()); err != ErrorTooManyInvocations {
+			t.Errorf("acquire(), received error %v, expected %v", err, ErrorTooManyInvocations)
+		}
+	})
+
+	t.Run("queued invocations time out", func(t *testing.T) {
+		l := newLimiter(1, 1, 10*time.Millisecond)
+		l.acquire(context.Background())
+		if _, err := l.acquire(context.Background()); err != ErrorQueueTimeout {
+			t.Errorf("acquire(), received error %v, expected %v", err, ErrorQueueTimeout)
+		}
+		if queued := l.queueLength(); queued != 0 {
+			t.Errorf("queueLength() = %d after timeout, expected 0", queued)
+		}
+	})
+
+	t.Run("queued invocations are cancelled with their context", func(t *testing.T) {
+		l := newLimiter(1, 1, time.Second)
+		l.acquire(context.Background())
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := l.acquire(ctx); err != ErrorExecutionTimeout {
+			t.Errorf("acquire(), received error %v, expected %v", err, ErrorExecutionTimeout)
+		}
+	})
+
+	t.Run("released slot is given to queued invocation", func(t *testing.T) {
+		l := newLimiter(1, 1, time.Second)
+		release, _ := l.acquire(context.Background())
+
+		acquired := make(chan error)
+		go func() {
+			_, err := l.acquire(context.Background())
+			acquired <- err
+		}()
+		for l.queueLength() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		release()
+		// Releasing twice must not free another slot
+		release()
+		if err := <-acquired; err != nil {
+			t.Fatalf("acquire(), received error %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := l.acquire(ctx); err == nil {
+			t.Errorf("acquire(), expected an error as the only slot is held")
+		}
+	})
+}
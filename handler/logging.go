@@ -2,21 +2,137 @@ package handler
 
 import (
 	"bufio"
+	"bytes"
 	"io"
-	"log"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/scaleway/functions-runtime/logging"
+)
+
+const (
+	// maxLogLineSize - size in bytes after which output without newline is logged as a line
+	maxLogLineSize = bufio.MaxScanTokenSize
+	// outputDrainDelay - time after an invocation completed during which output is still attributed to it
+	outputDrainDelay = 500 * time.Millisecond
 )
 
-// bindLoggingPipe spawns a goroutine for passing through logging of the given output pipe.
-func bindLoggingPipe(name string, pipe io.Reader, output io.Writer) {
-	scanner := bufio.NewScanner(pipe)
-	logger := log.New(output, log.Prefix(), log.Flags())
+// loggingWriter - logs an output stream of a sub-runtime line by line, as structured entries
+type loggingWriter struct {
+	logger *logging.Logger
+	// level of lines which do not set one, they are logged whatever the level of the core runtime
+	level       logging.Level
+	invocations *invocationTracker
+
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func newLoggingWriter(name string, output io.Writer, level logging.Level, w *worker) *loggingWriter {
+	return &loggingWriter{
+		level: level,
+		logger: logging.Default().WithOutput(output).WithFields(logging.Fields{
+			logging.KeyStream: name,
+			logging.KeyWorker: w.index,
+		}),
+		invocations: &w.invocations,
+	}
+}
+
+// Write buffers the given output, and logs every complete line, lines longer than maxLogLineSize are split
+func (w *loggingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	go func() {
-		for scanner.Scan() {
-			logger.Printf("%s: %s", name, scanner.Text())
+	w.buffer.Write(p)
+	for {
+		index := bytes.IndexByte(w.buffer.Bytes(), '\n')
+		if index < 0 && w.buffer.Len() < maxLogLineSize {
+			break
+		} else if index < 0 || index >= maxLogLineSize {
+			w.log(w.buffer.Next(maxLogLineSize))
+			continue
 		}
-		if err := scanner.Err(); err != nil {
-			log.Printf("Error scanning %s: %s", name, err.Error())
+		w.log(bytes.TrimRight(w.buffer.Next(index+1), "\r\n"))
+	}
+
+	return len(p), nil
+}
+
+// flush - log the remaining output, whose last line may not end with a newline, once the process exited
+func (w *loggingWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.buffer.Len() > 0 {
+		w.log(bytes.TrimRight(w.buffer.Next(w.buffer.Len()), "\r\n"))
+	}
+}
+
+func (w *loggingWriter) log(line []byte) {
+	// Tag lines with the invocation being handled, so that they can be attributed to it
+	logger := w.logger
+	if invocationIDs := w.invocations.current(); invocationIDs != "" {
+		logger = logger.With(logging.KeyInvocationID, invocationIDs)
+	}
+	logger.LogOutput(w.level, line)
+}
+
+// flushOutput - log the remaining output of the given command, once it exited
+func flushOutput(cmd *exec.Cmd) {
+	for _, output := range []io.Writer{cmd.Stdout, cmd.Stderr} {
+		if w, ok := output.(*loggingWriter); ok {
+			w.flush()
 		}
-	}()
+	}
+}
+
+// invocationTracker - invocations currently handled by the sub-runtime, used to attribute its output
+type invocationTracker struct {
+	mu  sync.Mutex
+	ids []string
+	// last invocation which completed, output written within outputDrainDelay after it completed is attributed to it
+	last     string
+	lastDone time.Time
+}
+
+// start tracking the given invocation, the returned function stops tracking it
+func (t *invocationTracker) start(id string) func() {
+	if id == "" {
+		return func() {}
+	}
+
+	t.mu.Lock()
+	t.ids = append(t.ids, id)
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			for i, current := range t.ids {
+				if current == id {
+					t.ids = append(t.ids[:i], t.ids[i+1:]...)
+					break
+				}
+			}
+			t.last, t.lastDone = id, time.Now()
+		})
+	}
+}
+
+// current - invocation being handled, or the last one within outputDrainDelay, empty if several run concurrently
+func (t *invocationTracker) current() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case len(t.ids) == 1:
+		return t.ids[0]
+	case len(t.ids) == 0 && t.last != "" && time.Since(t.lastDone) <= outputDrainDelay:
+		return t.last
+	default:
+		return ""
+	}
 }
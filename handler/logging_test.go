@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scaleway/functions-runtime/logging"
+)
+
+// loggedMessages - messages of the JSON entries written to the given output
+func loggedMessages(t *testing.T, output *bytes.Buffer) []string {
+	messages := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log entry %q: %v", line, err)
+		}
+		message, _ := entry["msg"].(string)
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func TestLoggingWriter(t *testing.T) {
+	t.Run("complete lines", func(t *testing.T) {
+		var output bytes.Buffer
+		w := newLoggingWriter("stdout", &output, logging.LevelInfo, &worker{})
+		w.Write([]byte("first\nsec"))
+		w.Write([]byte("ond\r\nthird"))
+		if messages := loggedMessages(t, &output); strings.Join(messages, "|") != "first|second" {
+			t.Errorf("messages = %q, expected first and second", messages)
+		}
+
+		// The last line is logged once the process exited, even without newline
+		w.flush()
+		if messages := loggedMessages(t, &output); strings.Join(messages, "|") != "first|second|third" {
+			t.Errorf("messages = %q, expected first, second and third", messages)
+		}
+		w.flush()
+		if messages := loggedMessages(t, &output); len(messages) != 3 {
+			t.Errorf("messages = %q, expected nothing more after the flush", messages)
+		}
+	})
+
+	t.Run("long lines", func(t *testing.T) {
+		var output bytes.Buffer
+		w := newLoggingWriter("stdout", &output, logging.LevelInfo, &worker{})
+		w.Write([]byte(strings.Repeat("a", maxLogLineSize+10)))
+		if w.buffer.Len() != 10 {
+			t.Errorf("buffered %d bytes, expected 10", w.buffer.Len())
+		}
+		w.Write([]byte("\n"))
+		messages := loggedMessages(t, &output)
+		if len(messages) != 2 || len(messages[0]) != maxLogLineSize || messages[1] != strings.Repeat("a", 10) {
+			t.Errorf("logged %d messages, expected a line of %d bytes then the remaining 10 bytes", len(messages), maxLogLineSize)
+		}
+	})
+}
+
+func TestLoggingWriterLevel(t *testing.T) {
+	defer logging.SetDefault(logging.Default())
+	logging.SetDefault(logging.New(&bytes.Buffer{}, logging.FormatJSON, logging.LevelError))
+
+	var output bytes.Buffer
+	w := newLoggingWriter("stderr", &output, logging.LevelInfo, &worker{})
+	w.Write([]byte("INFO:     127.0.0.1:40000 - \"GET /hello HTTP/1.1\" 200 OK\n" +
+		`{"msg": "debug details", "level": "debug"}` + "\n" + `{"msg": "failed", "level": "error"}` + "\n"))
+
+	expected := []map[string]interface{}{
+		// Lines without level are always logged, at the level of the stream
+		{"msg": `INFO:     127.0.0.1:40000 - "GET /hello HTTP/1.1" 200 OK`, "level": "info"},
+		{"msg": "failed", "level": "error"},
+	}
+	decoder := json.NewDecoder(&output)
+	for _, fields := range expected {
+		var entry map[string]interface{}
+		if err := decoder.Decode(&entry); err != nil {
+			t.Fatalf("expected an entry with %v, received error %v", fields, err)
+		}
+		for key, value := range fields {
+			if entry[key] != value {
+				t.Errorf("entry = %v, expected %s %v", entry, key, value)
+			}
+		}
+	}
+	if decoder.More() {
+		t.Error("expected the debug line to be filtered")
+	}
+}
+
+func TestInvocationTracker(t *testing.T) {
+	var tracker invocationTracker
+	if id := tracker.current(); id != "" {
+		t.Errorf("current() = %q before any invocation, expected none", id)
+	}
+
+	untrackFirst := tracker.start("first")
+	if id := tracker.current(); id != "first" {
+		t.Errorf("current() = %q, expected first", id)
+	}
+
+	untrackSecond := tracker.start("second")
+	if id := tracker.current(); id != "" {
+		t.Errorf("current() = %q with concurrent invocations, expected none", id)
+	}
+	untrackFirst()
+	if id := tracker.current(); id != "second" {
+		t.Errorf("current() = %q, expected second", id)
+	}
+
+	// Output flushed shortly after the response is still attributed to the invocation
+	untrackSecond()
+	if id := tracker.current(); id != "second" {
+		t.Errorf("current() = %q right after second completed, expected second", id)
+	}
+	tracker.lastDone = tracker.lastDone.Add(-outputDrainDelay - time.Millisecond)
+	if id := tracker.current(); id != "" {
+		t.Errorf("current() = %q once drained, expected none", id)
+	}
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// errorInvalidStat - /proc/<pid>/stat file does not have the expected format
+var errorInvalidStat = errors.New("invalid process stat")
+
+// processGroupsMemory - resident memory in bytes of every process group, read from /proc so that processes
+// spawned by the sub-runtime (e.g. gunicorn workers) are accounted for, a single scan serves all the workers
+func processGroupsMemory() (map[int]uint64, error) {
+	stats, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return nil, err
+	}
+	if len(stats) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	pageSize := uint64(os.Getpagesize())
+	groups := map[int]uint64{}
+	for _, path := range stats {
+		stat, err := ioutil.ReadFile(path)
+		if err != nil {
+			// Process terminated in the meantime
+			continue
+		}
+		group, rss, err := parseProcessStat(stat)
+		if err != nil {
+			// Other processes are still accounted for
+			continue
+		}
+		groups[group] += rss * pageSize
+	}
+	return groups, nil
+}
+
+// parseProcessStat - process group and resident set size in pages, from the content of /proc/<pid>/stat
+// see proc(5), the command name may contain spaces and parentheses so fields are read after its last parenthesis
+func parseProcessStat(stat []byte) (pgid int, rss uint64, err error) {
+	end := bytes.LastIndexByte(stat, ')')
+	if end < 0 {
+		return 0, 0, errorInvalidStat
+	}
+	// Fields following the command name, starting with the state (3rd field)
+	fields := bytes.Fields(stat[end+1:])
+	if len(fields) < 22 {
+		return 0, 0, errorInvalidStat
+	}
+
+	if pgid, err = strconv.Atoi(string(fields[2])); err != nil {
+		return 0, 0, errorInvalidStat
+	}
+	if rss, err = strconv.ParseUint(string(fields[21]), 10, 64); err != nil {
+		return 0, 0, errorInvalidStat
+	}
+	return pgid, rss, nil
+}
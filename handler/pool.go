@@ -0,0 +1,550 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/scaleway/functions-runtime/logging"
+)
+
+const (
+	// recycleTimeout - Time given to a recycled sub-runtime process to terminate after SIGTERM before it is killed
+	recycleTimeout = 5 * time.Second
+	// memorySampleInterval - Interval between two measures of the memory of workers, when it is limited
+	memorySampleInterval = time.Second
+	// DefaultWorkerIdleTimeout - Time after which an idle worker above the minimum is stopped, when none is configured
+	DefaultWorkerIdleTimeout = time.Minute
+)
+
+// worker - a supervised sub-runtime process of the pool, listening on its own upstream URL or Unix socket
+type worker struct {
+	// overSocket is accessed atomically, 1 when the running process listens on socketPath rather than upstreamURL
+	overSocket   int32
+	index        int
+	upstreamURL  string
+	socketPath   string
+	tcpClient    *http.Client
+	socketClient *http.Client
+	supervisor   *supervisor
+	invocations  invocationTracker
+	// conn is the framed protocol connection of the running process, when the stdio protocol is used
+	connMu sync.Mutex
+	conn   *frameConn
+	// lambda serves the Lambda Runtime API to the processes of the worker, when the lambda protocol is used
+	lambda *lambdaRuntimeAPI
+
+	// Following fields are guarded by the mutex of the pool
+	inFlight int
+	lastUsed time.Time
+	// process which handled and baselineMemory refer to, baselineMemory is 0 until sampled after an invocation
+	process        *process
+	handled        int
+	baselineMemory uint64
+	// draining workers do not receive new invocations, they are recycled once in-flight invocations complete
+	draining bool
+	// recycled process is being replaced, it does not receive new invocations while it terminates
+	recycled *process
+	// removed workers are being stopped, as they were idle
+	removed bool
+}
+
+// available - process of the worker which can receive invocations, nil if there is none
+func (w *worker) available() *process {
+	if w.draining || w.removed {
+		return nil
+	}
+	p := w.supervisor.running()
+	if p == w.recycled || !p.isReady() {
+		return nil
+	}
+	return p
+}
+
+// close - release what the worker holds once its processes are not supervised anymore
+func (w *worker) close() {
+	if w.lambda != nil {
+		w.lambda.close()
+	}
+}
+
+// pool - set of supervised workers handling invocations, scaled between minWorkers and maxWorkers on load
+type pool struct {
+	// Accessed atomically, kept first for 64-bit alignment on 32-bit platforms
+	retiredCrashes uint64
+	recycles       uint64
+	coldStart      int64
+
+	newWorker      func(index int) (*worker, error)
+	minWorkers     int
+	maxWorkers     int
+	maxInvocations int
+	maxMemory      uint64
+	idleTimeout    time.Duration
+
+	// started is closed the first time a worker becomes ready
+	started     chan struct{}
+	startedOnce sync.Once
+	startedAt   time.Time
+
+	mu      sync.Mutex
+	workers []*worker
+	// starting - indexes reserved by workers being spawned, which is done without holding the mutex
+	starting map[int]bool
+	spawning sync.WaitGroup
+	// changed is closed, and replaced, every time a worker may have become available
+	changed  chan struct{}
+	stopping bool
+	stop     chan struct{}
+	done     chan struct{}
+	err      error
+}
+
+func newPool(newWorker func(index int) (*worker, error), minWorkers, maxWorkers int, idleTimeout time.Duration) *pool {
+	if minWorkers < 1 {
+		minWorkers = 1
+	}
+	if maxWorkers < minWorkers {
+		maxWorkers = minWorkers
+	}
+	return &pool{
+		newWorker:   newWorker,
+		minWorkers:  minWorkers,
+		maxWorkers:  maxWorkers,
+		idleTimeout: idleTimeout,
+		starting:    make(map[int]bool),
+		started:     make(chan struct{}),
+		changed:     make(chan struct{}),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// start the minimum number of workers, an error is returned if one of them can not be spawned at all
+func (pl *pool) start() error {
+	pl.startedAt = time.Now()
+
+	for i := 0; i < pl.minWorkers; i++ {
+		pl.mu.Lock()
+		index := pl.reserveWorker()
+		pl.mu.Unlock()
+		if err := pl.addWorker(index); err != nil {
+			return err
+		}
+	}
+
+	if pl.maxWorkers > pl.minWorkers {
+		go pl.scaleDown()
+	}
+	if pl.maxMemory > 0 {
+		go pl.monitorMemory()
+	}
+	return nil
+}
+
+// reserveWorker - reserve the lowest free index for a new worker, must be called with the mutex held
+func (pl *pool) reserveWorker() int {
+	index := 0
+	for used := true; used; {
+		used = pl.starting[index]
+		for _, w := range pl.workers {
+			if w.index == index {
+				used = true
+				break
+			}
+		}
+		if used {
+			index++
+		}
+	}
+	pl.starting[index] = true
+	pl.spawning.Add(1)
+	return index
+}
+
+// addWorker - start a new worker on the given reserved index, must be called without the mutex held
+func (pl *pool) addWorker(index int) error {
+	defer pl.spawning.Done()
+
+	w, err := pl.newWorker(index)
+	if err != nil {
+		pl.unreserveWorker(index)
+		return err
+	}
+	w.lastUsed = time.Now()
+	w.supervisor.onReady = func(p *process) {
+		pl.startedOnce.Do(func() {
+			atomic.StoreInt64(&pl.coldStart, int64(time.Since(pl.startedAt)))
+			close(pl.started)
+		})
+		pl.notify()
+	}
+	if err := w.supervisor.start(); err != nil {
+		w.close()
+		pl.unreserveWorker(index)
+		return err
+	}
+
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	delete(pl.starting, index)
+	pl.workers = append(pl.workers, w)
+	go pl.watch(w)
+	// Worker may have become ready before being added
+	pl.notifyLocked()
+	return nil
+}
+
+// unreserveWorker - release the index reserved by a worker which could not be spawned
+func (pl *pool) unreserveWorker(index int) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	delete(pl.starting, index)
+}
+
+// watch - fail the pool when the worker gives up restarting, or forget it once removed and terminated
+func (pl *pool) watch(w *worker) {
+	<-w.supervisor.done
+	w.close()
+
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if !w.removed {
+		if !pl.stopping {
+			pl.finish(w.supervisor.failure())
+		}
+		return
+	}
+
+	atomic.AddUint64(&pl.retiredCrashes, atomic.LoadUint64(&w.supervisor.crashes))
+	for i, current := range pl.workers {
+		if current == w {
+			pl.workers = append(pl.workers[:i], pl.workers[i+1:]...)
+			break
+		}
+	}
+	pl.notifyLocked()
+}
+
+// finish - terminate the pool with the given error, must be called with the mutex held
+func (pl *pool) finish(err error) {
+	select {
+	case <-pl.done:
+	default:
+		pl.err = err
+		close(pl.done)
+	}
+}
+
+func (pl *pool) notify() {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.notifyLocked()
+}
+
+func (pl *pool) notifyLocked() {
+	close(pl.changed)
+	pl.changed = make(chan struct{})
+}
+
+// leastBusy - available worker handling the fewest invocations, must be called with the mutex held
+func (pl *pool) leastBusy() (*worker, *process) {
+	var best *worker
+	var bestProcess *process
+	for _, w := range pl.workers {
+		if p := w.available(); p != nil && (best == nil || w.inFlight < best.inFlight) {
+			best, bestProcess = w, p
+		}
+	}
+	return best, bestProcess
+}
+
+// shouldScaleUp - whether no available worker is idle and none is starting, must be called with the mutex held
+func (pl *pool) shouldScaleUp(best *worker) bool {
+	if best != nil && best.inFlight == 0 {
+		return false
+	}
+
+	if len(pl.starting) > 0 {
+		// A worker is being spawned, it will take the next invocations
+		return false
+	}
+
+	active := 0
+	for _, w := range pl.workers {
+		if w.removed {
+			continue
+		}
+		active++
+		if w.available() == nil && !w.draining {
+			// A worker is starting, or restarting, it will take the next invocations
+			return false
+		}
+	}
+	return active < pl.maxWorkers
+}
+
+// acquire - reserve the least busy worker for an invocation, waiting for a worker to be ready if none is
+func (pl *pool) acquire(ctx context.Context) (*worker, *process, error) {
+	for {
+		pl.mu.Lock()
+		if pl.stopping {
+			pl.mu.Unlock()
+			return nil, nil, ErrorSubRuntimeStopped
+		}
+
+		w, p := pl.leastBusy()
+		if pl.shouldScaleUp(w) {
+			go pl.scaleUp(pl.reserveWorker())
+		}
+		if w != nil {
+			w.inFlight++
+			w.lastUsed = time.Now()
+			pl.mu.Unlock()
+			return w, p, nil
+		}
+		changed := pl.changed
+		pl.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-pl.done:
+			return nil, nil, pl.failure()
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// scaleUp - start a new worker on the given reserved index, as invocations are waiting
+func (pl *pool) scaleUp(index int) {
+	if err := pl.addWorker(index); err != nil {
+		logging.Errorf("Unable to start a new worker: %v", err)
+	}
+}
+
+// release - a worker once an invocation completed, it is recycled once it handled too many invocations
+func (pl *pool) release(w *worker, p *process) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	w.inFlight--
+	w.lastUsed = time.Now()
+	if w.process != p {
+		// Memory is measured relative to the first sample after the first invocation, once the function has been loaded
+		w.process, w.handled, w.baselineMemory = p, 0, 0
+	}
+	w.handled++
+
+	if pl.maxInvocations > 0 && w.handled >= pl.maxInvocations && !w.draining {
+		logging.Infof("Recycling worker %d, it handled %d invocations", w.index, w.handled)
+		w.draining = true
+	}
+	pl.recycleDrained(w, p)
+}
+
+// recycleDrained - recycle a draining worker once it is idle, must be called with the mutex held
+func (pl *pool) recycleDrained(w *worker, p *process) {
+	if !w.draining || w.inFlight > 0 || p.hasExited() {
+		return
+	}
+	w.draining = false
+	pl.recycleLocked(w, p, recycleTimeout)
+}
+
+// recycleNow - replace the given unusable process of a worker whatever its in-flight invocations
+func (pl *pool) recycleNow(w *worker, p *process, timeout time.Duration) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	w.draining = false
+	pl.recycleLocked(w, p, timeout)
+}
+
+// recycleLocked - recycle the given process of a worker unless it is already, called with the mutex of the pool held
+func (pl *pool) recycleLocked(w *worker, p *process, timeout time.Duration) {
+	// The process may already have been replaced, or the worker be stopping
+	if w.recycled != p && w.supervisor.recycle(p, timeout) {
+		atomic.AddUint64(&pl.recycles, 1)
+		w.recycled = p
+	}
+}
+
+// monitorMemory - periodically recycle workers whose memory grew too much since their first invocation
+func (pl *pool) monitorMemory() {
+	ticker := time.NewTicker(memorySampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-pl.stop:
+			return
+		}
+
+		groups, err := processGroupsMemory()
+		if err != nil {
+			continue
+		}
+
+		pl.mu.Lock()
+		for _, w := range pl.workers {
+			p := w.process
+			if p == nil || p.cmd.Process == nil || p != w.supervisor.running() || w.draining || w.removed {
+				continue
+			}
+			memory := groups[p.cmd.Process.Pid]
+			if w.baselineMemory == 0 {
+				w.baselineMemory = memory
+				continue
+			}
+			if memory > w.baselineMemory && memory-w.baselineMemory > pl.maxMemory {
+				logging.Infof("Recycling worker %d, its memory grew by %d bytes", w.index, memory-w.baselineMemory)
+				w.draining = true
+				pl.recycleDrained(w, p)
+			}
+		}
+		pl.mu.Unlock()
+	}
+}
+
+// scaleDown - periodically stop workers which have been idle for too long, down to the minimum number of workers
+func (pl *pool) scaleDown() {
+	ticker := time.NewTicker(pl.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-pl.stop:
+			return
+		}
+
+		pl.mu.Lock()
+		active := 0
+		for _, w := range pl.workers {
+			if !w.removed {
+				active++
+			}
+		}
+		for _, w := range pl.workers {
+			if active <= pl.minWorkers {
+				break
+			}
+			if !w.removed && w.inFlight == 0 && time.Since(w.lastUsed) > pl.idleTimeout {
+				logging.Infof("Stopping worker %d, idle for %v", w.index, time.Since(w.lastUsed))
+				w.removed = true
+				w.supervisor.terminate()
+				active--
+			}
+		}
+		pl.mu.Unlock()
+	}
+}
+
+// ready - wait until a worker is ready to handle invocations, without reserving it
+func (pl *pool) ready(ctx context.Context) error {
+	for {
+		pl.mu.Lock()
+		w, _ := pl.leastBusy()
+		changed := pl.changed
+		pl.mu.Unlock()
+		if w != nil {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-pl.done:
+			return pl.failure()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// available - least busy worker ready to handle invocations, nil if there is none
+func (pl *pool) available() *worker {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	w, _ := pl.leastBusy()
+	return w
+}
+
+// size - number of workers, including starting ones
+func (pl *pool) size() int {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return len(pl.workers) + len(pl.starting)
+}
+
+// inFlight - number of invocations being handled by workers
+func (pl *pool) inFlight() int {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	count := 0
+	for _, w := range pl.workers {
+		count += w.inFlight
+	}
+	return count
+}
+
+// crashes - number of times workers terminated unexpectedly
+func (pl *pool) crashes() uint64 {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	count := atomic.LoadUint64(&pl.retiredCrashes)
+	for _, w := range pl.workers {
+		count += atomic.LoadUint64(&w.supervisor.crashes)
+	}
+	return count
+}
+
+// terminate - stop scaling and send SIGTERM to all workers, the returned channel is closed once they terminated
+func (pl *pool) terminate() <-chan struct{} {
+	pl.mu.Lock()
+	if !pl.stopping {
+		pl.stopping = true
+		close(pl.stop)
+	}
+	pl.mu.Unlock()
+
+	terminated := make(chan struct{})
+	go func() {
+		// Workers being spawned are terminated as well, no new one is spawned once stopping
+		pl.spawning.Wait()
+		pl.mu.Lock()
+		workers := append([]*worker{}, pl.workers...)
+		pl.mu.Unlock()
+
+		for _, w := range workers {
+			w.supervisor.terminate()
+		}
+		for _, w := range workers {
+			<-w.supervisor.done
+		}
+		pl.mu.Lock()
+		pl.finish(ErrorSubRuntimeStopped)
+		pl.mu.Unlock()
+		close(terminated)
+	}()
+	return terminated
+}
+
+// kill - send SIGKILL to all workers, used when they do not terminate in time
+func (pl *pool) kill() {
+	pl.mu.Lock()
+	workers := append([]*worker{}, pl.workers...)
+	pl.mu.Unlock()
+
+	for _, w := range workers {
+		w.supervisor.kill()
+	}
+}
+
+func (pl *pool) failure() error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return pl.err
+}
@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newTestPool(minWorkers, maxWorkers int) *pool {
+	return newPool(func(index int) (*worker, error) {
+		w := &worker{index: index}
+		w.supervisor = newSupervisor(func() (*exec.Cmd, error) {
+			return exec.Command("sleep", "10"), nil
+		}, nil, 0, fixtureRestartPolicy)
+		return w, nil
+	}, minWorkers, maxWorkers, time.Minute)
+}
+
+func acquireWorker(t *testing.T, pl *pool) (*worker, *process) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	w, p, err := pl.acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire(), received error %v", err)
+	}
+	return w, p
+}
+
+func stopTestPool(t *testing.T, pl *pool) {
+	select {
+	case <-pl.terminate():
+	case <-time.After(5 * time.Second):
+		t.Fatal("pool did not terminate in time")
+	}
+}
+
+func TestPool(t *testing.T) {
+	t.Run("scales up when all workers are busy", func(t *testing.T) {
+		pl := newTestPool(1, 2)
+		if err := pl.start(); err != nil {
+			t.Fatalf("start(), received error %v", err)
+		}
+		defer stopTestPool(t, pl)
+
+		first, _ := acquireWorker(t, pl)
+		// Busy worker is still the least busy one, while a new worker is starting
+		if w, _ := acquireWorker(t, pl); w != first {
+			t.Errorf("acquire() returned worker %d, expected %d", w.index, first.index)
+		}
+		if size := pl.size(); size != 2 {
+			t.Fatalf("size() = %d, expected 2", size)
+		}
+		if err := pl.ready(context.Background()); err != nil {
+			t.Fatalf("ready(), received error %v", err)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if w, _ := acquireWorker(t, pl); w != first {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("new worker never received an invocation")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("does not hold invocations while spawning a worker", func(t *testing.T) {
+		spawn := make(chan struct{})
+		pl := newPool(func(index int) (*worker, error) {
+			if index > 0 {
+				<-spawn
+			}
+			w := &worker{index: index}
+			w.supervisor = newSupervisor(func() (*exec.Cmd, error) {
+				return exec.Command("sleep", "10"), nil
+			}, nil, 0, fixtureRestartPolicy)
+			return w, nil
+		}, 1, 2, time.Minute)
+		if err := pl.start(); err != nil {
+			t.Fatalf("start(), received error %v", err)
+		}
+		defer stopTestPool(t, pl)
+		defer close(spawn)
+
+		first, _ := acquireWorker(t, pl)
+		acquired := make(chan *worker, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				w, _ := acquireWorker(t, pl)
+				acquired <- w
+			}()
+		}
+		for i := 0; i < 2; i++ {
+			select {
+			case w := <-acquired:
+				if w != first {
+					t.Errorf("acquire() returned worker %d, expected %d", w.index, first.index)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("acquire() waited for the new worker to be spawned")
+			}
+		}
+		if size := pl.size(); size != 2 {
+			t.Errorf("size() = %d, expected the worker being spawned to be counted", size)
+		}
+	})
+
+	t.Run("recycles workers after too many invocations", func(t *testing.T) {
+		pl := newTestPool(1, 1)
+		pl.maxInvocations = 2
+		if err := pl.start(); err != nil {
+			t.Fatalf("start(), received error %v", err)
+		}
+		defer stopTestPool(t, pl)
+
+		w, p := acquireWorker(t, pl)
+		pl.release(w, p)
+		w, p = acquireWorker(t, pl)
+		pl.release(w, p)
+
+		if next, _ := acquireWorker(t, pl); next.supervisor.running() == p {
+			t.Error("acquire() returned the recycled process")
+		}
+		if recycles := atomic.LoadUint64(&pl.recycles); recycles != 1 {
+			t.Errorf("recycles = %d, expected 1", recycles)
+		}
+		if crashes := pl.crashes(); crashes != 0 {
+			t.Errorf("crashes() = %d, recycled process should not be counted as crashed", crashes)
+		}
+	})
+
+	t.Run("recycles unusable processes right away", func(t *testing.T) {
+		pl := newTestPool(1, 1)
+		if err := pl.start(); err != nil {
+			t.Fatalf("start(), received error %v", err)
+		}
+		defer stopTestPool(t, pl)
+
+		w, p := acquireWorker(t, pl)
+		pl.recycleNow(w, p, 0)
+		pl.recycleNow(w, p, 0)
+		pl.release(w, p)
+
+		if next, _ := acquireWorker(t, pl); next.supervisor.running() == p {
+			t.Error("acquire() returned the recycled process")
+		}
+		if recycles := atomic.LoadUint64(&pl.recycles); recycles != 1 {
+			t.Errorf("recycles = %d, expected 1", recycles)
+		}
+	})
+
+	t.Run("does not count recycles of replaced processes", func(t *testing.T) {
+		pl := newTestPool(1, 1)
+		if err := pl.start(); err != nil {
+			t.Fatalf("start(), received error %v", err)
+		}
+		defer stopTestPool(t, pl)
+
+		w, _ := acquireWorker(t, pl)
+		stale := &process{exited: make(chan struct{})}
+		pl.mu.Lock()
+		w.inFlight--
+		w.draining = true
+		pl.recycleDrained(w, stale)
+		pl.mu.Unlock()
+
+		if recycles := atomic.LoadUint64(&pl.recycles); recycles != 0 {
+			t.Errorf("recycles = %d, expected 0", recycles)
+		}
+		if w.recycled != nil {
+			t.Error("recycled should not point at a process which was not recycled")
+		}
+	})
+
+	t.Run("fails when a worker gives up", func(t *testing.T) {
+		pl := newPool(func(index int) (*worker, error) {
+			w := &worker{index: index}
+			w.supervisor = newSupervisor(func() (*exec.Cmd, error) {
+				return exec.Command("sh", "-c", "exit 1"), nil
+			}, nil, 0, fixtureRestartPolicy)
+			return w, nil
+		}, 1, 1, time.Minute)
+		if err := pl.start(); err != nil {
+			t.Fatalf("start(), received error %v", err)
+		}
+
+		select {
+		case <-pl.done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("pool did not terminate in time")
+		}
+		if pl.failure() == nil || pl.failure() == ErrorSubRuntimeStopped {
+			t.Errorf("failure() = %v, expected the error of the worker", pl.failure())
+		}
+	})
+}
+
+func TestWorkerUpstream(t *testing.T) {
+	tests := []struct {
+		upstreamURL string
+		index       int
+		expectedURL string
+		expectErr   bool
+	}{
+		{"http://127.0.0.1:8081", 0, "http://127.0.0.1:8081", false},
+		{"http://127.0.0.1:8081", 2, "http://127.0.0.1:8083", false},
+		{"http://localhost:8081/", 1, "http://localhost:8082/", false},
+		{"http://127.0.0.1", 0, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.upstreamURL, func(t *testing.T) {
+			url, _, err := workerUpstream(test.upstreamURL, test.index)
+			if (err != nil) != test.expectErr || url != test.expectedURL {
+				t.Errorf("workerUpstream(%s, %d) = %s, %v, expected %s", test.upstreamURL, test.index, url, err, test.expectedURL)
+			}
+		})
+	}
+}
+
+func TestProcessGroupsMemory(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 10 & sleep 10 & wait")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start(), received error %v", err)
+	}
+	defer func() {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		cmd.Wait()
+	}()
+
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", cmd.Process.Pid))
+	if err != nil {
+		t.Skipf("/proc is not available: %v", err)
+	}
+	_, leaderPages, _ := parseProcessStat(stat)
+	leader := leaderPages * uint64(os.Getpagesize())
+
+	// Children are accounted for in the group of the sub-runtime once they have been spawned
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		groups, err := processGroupsMemory()
+		if err != nil {
+			t.Fatalf("processGroupsMemory(), received error %v", err)
+		}
+		if groups[cmd.Process.Pid] > leader {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("memory = %d, expected more than the %d bytes of the group leader", groups[cmd.Process.Pid], leader)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestParseProcessStat(t *testing.T) {
+	pgid, rss, err := parseProcessStat([]byte("42 (my (weird) cmd) S 1 40 40 0 -1 4194560 100 0 0 0 1 2 0 0 20 0 1 0 100 2703360 327 18446744073709551615"))
+	if err != nil || pgid != 40 || rss != 327 {
+		t.Errorf("parseProcessStat() = %d, %d, %v, expected 40, 327", pgid, rss, err)
+	}
+
+	if _, _, err := parseProcessStat([]byte("42 (cmd) S 1")); err != errorInvalidStat {
+		t.Errorf("parseProcessStat() error = %v, expected %v", err, errorInvalidStat)
+	}
+}
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"sync/atomic"
+
+	"github.com/scaleway/functions-runtime/framing"
+	"github.com/scaleway/functions-runtime/logging"
+)
+
+// Protocols spoken between the core runtime and sub-runtimes
+const (
+	// ProtocolHTTP - sub-runtimes run an HTTP server, on the upstream port or Unix socket
+	ProtocolHTTP = "http"
+	// ProtocolStdio - sub-runtimes read invocations on their standard input and write responses on their standard
+	// output, see package framing
+	ProtocolStdio = "stdio"
+	// ProtocolLambda - sub-runtimes are AWS Lambda runtimes, fetching invocations from the Lambda Runtime API
+	// served by the core runtime on the upstream port, see lambda.go
+	ProtocolLambda = "lambda"
+)
+
+var (
+	// errorOutputClosed - Error type for invocations sent to a sub-runtime whose standard output has been closed
+	errorOutputClosed = errors.New("sub-runtime output has been closed")
+	// errorStreamBroken - Error type for invocations sent to a sub-runtime after an invocation was abandoned
+	errorStreamBroken = errors.New("sub-runtime frame stream is broken by an abandoned invocation")
+)
+
+type frame struct {
+	frameType framing.Type
+	payload   []byte
+}
+
+// frameConn - framed protocol connection to the standard input and output of a sub-runtime process,
+// invocations are sent one at a time
+type frameConn struct {
+	// broken is accessed atomically, 1 once an invocation was abandoned while being written or handled
+	broken int32
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	frames chan frame
+	err    error
+
+	// turn is held by the invocation being sent, it is a channel rather than a mutex so that waiting for it can be
+	// cancelled
+	turn chan struct{}
+}
+
+// newFrameConn - bind a framed protocol connection to the standard input and output of the given command,
+// which must not be started yet
+func newFrameConn(cmd *exec.Cmd) (*frameConn, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &frameConn{cmd: cmd, stdin: stdin, frames: make(chan frame), turn: make(chan struct{}, 1)}
+	go c.read(bufio.NewReader(stdout))
+	return c, nil
+}
+
+// read frames written by the sub-runtime until its output is closed, or is not a valid frame stream
+func (c *frameConn) read(r io.Reader) {
+	defer close(c.frames)
+	for {
+		frameType, payload, err := framing.Read(r)
+		if err != nil {
+			c.err = err
+			return
+		}
+		c.frames <- frame{frameType: frameType, payload: payload}
+	}
+}
+
+// next - wait for the next frame written by the sub-runtime
+func (c *frameConn) next(ctx context.Context) (frame, error) {
+	select {
+	case f, ok := <-c.frames:
+		if !ok {
+			if c.err == io.EOF || c.err == nil {
+				return frame{}, errorOutputClosed
+			}
+			return frame{}, c.err
+		}
+		return f, nil
+	case <-ctx.Done():
+		return frame{}, ctx.Err()
+	}
+}
+
+// invoke - send the given request to the sub-runtime, and wait for its response
+func (c *frameConn) invoke(ctx context.Context, request []byte) (frame, error) {
+	select {
+	case c.turn <- struct{}{}:
+	case <-ctx.Done():
+		return frame{}, ctx.Err()
+	}
+	defer func() { <-c.turn }()
+
+	if c.isBroken() {
+		return frame{}, errorStreamBroken
+	}
+
+	if err := c.write(ctx, request); err != nil {
+		return frame{}, err
+	}
+	response, err := c.next(ctx)
+	if err != nil && err == ctx.Err() {
+		// Sub-runtime may never answer, its response can not be told apart from the one of the next invocation
+		atomic.StoreInt32(&c.broken, 1)
+	}
+	return response, err
+}
+
+// write an invocation frame, giving up when the context is done as the sub-runtime may not read its input
+// anymore, the frame stream is then broken: the sub-runtime would read the rest of the frame as a new one
+func (c *frameConn) write(ctx context.Context, request []byte) error {
+	written := make(chan error, 1)
+	go func() {
+		written <- framing.Write(c.stdin, framing.TypeInvocation, request)
+	}()
+
+	select {
+	case err := <-written:
+		return err
+	case <-ctx.Done():
+		atomic.StoreInt32(&c.broken, 1)
+		return ctx.Err()
+	}
+}
+
+// isBroken - whether an invocation was not entirely written or not answered, the process must then be replaced
+func (c *frameConn) isBroken() bool {
+	return atomic.LoadInt32(&c.broken) == 1
+}
+
+// frameConn - framed protocol connection of the running process of the worker
+func (w *worker) frameConn() *frameConn {
+	w.connMu.Lock()
+	defer w.connMu.Unlock()
+	return w.conn
+}
+
+func (w *worker) setFrameConn(conn *frameConn) {
+	w.connMu.Lock()
+	defer w.connMu.Unlock()
+	w.conn = conn
+}
+
+// invokeFramed - send the given request to a sub-runtime process over its standard input, its response
+// is returned as the response of a sub-runtime HTTP server would be
+func (fn *FunctionInvoker) invokeFramed(ctx context.Context, w *worker, p *process, request []byte) (*http.Response, error) {
+	conn := w.frameConn()
+	if conn == nil || conn.cmd != p.cmd {
+		return nil, ErrorSubRuntimeCrashed
+	}
+
+	requestCtx, cancel := processContext(ctx, p)
+	defer cancel()
+	response, err := conn.invoke(requestCtx, request)
+	if err != nil {
+		if conn.isBroken() {
+			logging.Warnf("Recycling worker %d, it did not handle an invocation in time", w.index)
+			fn.pool.recycleNow(w, p, 0)
+		}
+		return nil, requestError(ctx, p, err)
+	}
+
+	status := http.StatusOK
+	if response.frameType == framing.TypeError {
+		status = http.StatusInternalServerError
+	}
+	return &http.Response{
+		StatusCode: status,
+		Body:       ioutil.NopCloser(bytes.NewReader(response.payload)),
+	}, nil
+}
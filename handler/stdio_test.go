@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/scaleway/functions-runtime/framing"
+)
+
+func startFrameConn(t *testing.T, name string, args ...string) *frameConn {
+	cmd := exec.Command(name, args...)
+	conn, err := newFrameConn(cmd)
+	if err != nil {
+		t.Fatalf("newFrameConn(), received error %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start(), received error %v", err)
+	}
+	go cmd.Wait()
+	return conn
+}
+
+func TestFrameConn(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("round trip", func(t *testing.T) {
+		// cat sends invocation frames back as they are
+		conn := startFrameConn(t, "cat")
+		defer conn.stdin.Close()
+
+		for _, request := range []string{`{"event":1}`, `{"event":2}`} {
+			response, err := conn.invoke(ctx, []byte(request))
+			if err != nil {
+				t.Fatalf("invoke(), received error %v", err)
+			}
+			if response.frameType != framing.TypeInvocation || string(response.payload) != request {
+				t.Errorf("invoke() = %q %s, expected %s", response.frameType, response.payload, request)
+			}
+		}
+	})
+
+	t.Run("output closed", func(t *testing.T) {
+		conn := startFrameConn(t, "true")
+		if _, err := conn.invoke(ctx, []byte(`{}`)); err == nil {
+			t.Error("invoke(), expected an error as the sub-runtime terminated")
+		}
+	})
+
+	t.Run("input not read", func(t *testing.T) {
+		// The invocation does not fit in the pipe buffer, and sleep never reads it
+		conn := startFrameConn(t, "sleep", "10")
+		defer conn.cmd.Process.Kill()
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		request := bytes.Repeat([]byte("a"), 1<<20)
+		if _, err := conn.invoke(timeoutCtx, request); err != context.DeadlineExceeded {
+			t.Fatalf("invoke(), received error %v, expected %v", err, context.DeadlineExceeded)
+		}
+		if !conn.isBroken() {
+			t.Error("isBroken() = false, expected the frame stream to be broken")
+		}
+		if _, err := conn.invoke(ctx, []byte(`{}`)); err != errorStreamBroken {
+			t.Errorf("invoke(), received error %v, expected %v", err, errorStreamBroken)
+		}
+	})
+
+	t.Run("waiting for the previous invocation", func(t *testing.T) {
+		// sleep never answers, invocations waiting for their turn must time out
+		conn := startFrameConn(t, "sleep", "10")
+		defer conn.cmd.Process.Kill()
+
+		go conn.invoke(ctx, []byte(`{}`))
+		time.Sleep(50 * time.Millisecond)
+		timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		if _, err := conn.invoke(timeoutCtx, []byte(`{}`)); err != context.DeadlineExceeded {
+			t.Errorf("invoke(), received error %v, expected %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("response not received", func(t *testing.T) {
+		// sleep never answers, its response could be mistaken for the one of the next invocation
+		conn := startFrameConn(t, "sleep", "10")
+		defer conn.cmd.Process.Kill()
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		if _, err := conn.invoke(timeoutCtx, []byte(`{}`)); err != context.DeadlineExceeded {
+			t.Fatalf("invoke(), received error %v, expected %v", err, context.DeadlineExceeded)
+		}
+		if !conn.isBroken() {
+			t.Error("isBroken() = false, expected the frame stream to be broken")
+		}
+	})
+
+	t.Run("invalid output", func(t *testing.T) {
+		conn := startFrameConn(t, "sh", "-c", "echo hello; sleep 1")
+		if _, err := conn.invoke(ctx, []byte(`{}`)); err == nil || err == errorOutputClosed {
+			t.Errorf("invoke(), received error %v, expected an invalid frame error", err)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// ResponseStreamContentType - Content type of sub-runtime responses streaming their body: their first line is the
+// JSON status code and headers of the response (e.g. {"statusCode": 200, "headers": {...}}), followed by the raw body
+const ResponseStreamContentType = "application/vnd.scw.response-stream"
+
+// StreamedResponse - response of a handler streaming its body, its status code and headers are known before
+// the body is read, so that they can be sent to the client first
+type StreamedResponse struct {
+	io.ReadCloser
+	StatusCode int
+	Headers    map[string]string
+}
+
+// newStreamedResponse - read the status code and headers of a streamed sub-runtime response, the remaining of
+// the given body is the body of the response
+func newStreamedResponse(body io.ReadCloser) (*StreamedResponse, error) {
+	reader := bufio.NewReader(body)
+	line, err := reader.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	var metadata ResponseHTTP
+	if err := json.Unmarshal(line, &metadata); err != nil {
+		return nil, ErrorInvalidHTTPResponseFormat
+	}
+	streamed := &StreamedResponse{
+		ReadCloser: &readCloser{Reader: reader, Closer: body},
+		StatusCode: http.StatusOK,
+		Headers:    metadata.Headers,
+	}
+	if metadata.StatusCode != nil {
+		streamed.StatusCode = *metadata.StatusCode
+	}
+	return streamed, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNewStreamedResponse(t *testing.T) {
+	tests := []struct {
+		name           string
+		response       string
+		expectedStatus int
+		expectedHeader string
+		expectedBody   string
+		expectedErr    error
+	}{
+		{"status and headers", "{\"statusCode\":201,\"headers\":{\"Content-Type\":\"text/event-stream\"}}\ndata: 1\n\ndata: 2\n\n",
+			http.StatusCreated, "text/event-stream", "data: 1\n\ndata: 2\n\n", nil},
+		{"default status", "{}\nhello", http.StatusOK, "", "hello", nil},
+		{"empty body", "{\"statusCode\":204}", http.StatusNoContent, "", "", nil},
+		{"invalid metadata", "hello\nworld", 0, "", "", ErrorInvalidHTTPResponseFormat},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			streamed, err := newStreamedResponse(ioutil.NopCloser(strings.NewReader(test.response)))
+			if err != test.expectedErr {
+				t.Fatalf("newStreamedResponse(), received error %v, expected %v", err, test.expectedErr)
+			}
+			if err != nil {
+				return
+			}
+			body, _ := ioutil.ReadAll(streamed)
+			if streamed.StatusCode != test.expectedStatus || streamed.Headers["Content-Type"] != test.expectedHeader || string(body) != test.expectedBody {
+				t.Errorf("newStreamedResponse() = %d %v %q, expected %d %s %q", streamed.StatusCode, streamed.Headers, body,
+					test.expectedStatus, test.expectedHeader, test.expectedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/scaleway/functions-runtime/logging"
+)
+
+const (
+	probeInterval = time.Millisecond * 50
+)
+
+// RestartPolicy - Configuration of the supervision of the sub-runtime process
+type RestartPolicy struct {
+	// InitialBackoff - Delay before restarting a crashed sub-runtime, doubled after each consecutive crash
+	InitialBackoff time.Duration
+	// MaxBackoff - Upper bound of the delay between two restarts
+	MaxBackoff time.Duration
+	// MaxCrashes - Number of crashes tolerated within CrashWindow before giving up (0 means never give up)
+	MaxCrashes int
+	// CrashWindow - Sliding window used to detect crash loops, a process running longer than this resets the backoff
+	CrashWindow time.Duration
+}
+
+// DefaultRestartPolicy - Restart policy used when none is configured
+var DefaultRestartPolicy = RestartPolicy{
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	MaxCrashes:     5,
+	CrashWindow:    time.Minute,
+}
+
+// process - a single run of the sub-runtime
+type process struct {
+	cmd       *exec.Cmd
+	startedAt time.Time
+	ready     chan struct{}
+	exited    chan struct{}
+	err       error
+}
+
+func (p *process) isReady() bool {
+	select {
+	case <-p.ready:
+		return !p.hasExited()
+	default:
+		return false
+	}
+}
+
+func (p *process) hasExited() bool {
+	select {
+	case <-p.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *process) wait() error {
+	<-p.exited
+	return p.err
+}
+
+// signal - send the given signal to the whole process group of the sub-runtime, so that processes it spawned
+// (e.g. gunicorn workers started by a shell script) are also reached
+func (p *process) signal(sig syscall.Signal) {
+	if p.cmd.Process != nil && !p.hasExited() {
+		if err := syscall.Kill(-p.cmd.Process.Pid, sig); err != nil {
+			p.cmd.Process.Signal(sig)
+		}
+	}
+}
+
+// supervisor - keeps the sub-runtime alive by restarting it with an exponential backoff when it crashes,
+// and gives up once it crashed more than allowed by the restart policy
+type supervisor struct {
+	// crashes is accessed atomically, keep it first for 64-bit alignment on 32-bit platforms
+	crashes    uint64
+	newCommand func() (*exec.Cmd, error)
+	policy     RestartPolicy
+	// probe checks once whether a process is ready to handle invocations, processes are ready as soon as
+	// they are started when it is nil
+	probe          func(ctx context.Context) error
+	startupTimeout time.Duration
+	// onReady is called every time a process becomes ready, if set before calling start
+	onReady func(p *process)
+	logger  *logging.Logger
+
+	mu        sync.Mutex
+	current   *process
+	spawned   chan struct{}
+	recycling *process
+	stopping  bool
+	stop      chan struct{}
+	done      chan struct{}
+	err       error
+}
+
+func newSupervisor(newCommand func() (*exec.Cmd, error), probe func(ctx context.Context) error, startupTimeout time.Duration, policy RestartPolicy) *supervisor {
+	return &supervisor{
+		newCommand:     newCommand,
+		policy:         policy,
+		probe:          probe,
+		startupTimeout: startupTimeout,
+		logger:         logging.Default(),
+		spawned:        make(chan struct{}),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+}
+
+// start the first sub-runtime process, an error is returned if it can not be spawned at all
+func (s *supervisor) start() error {
+	p, err := s.spawn()
+	if err != nil {
+		return err
+	}
+
+	go s.run(p)
+	return nil
+}
+
+// spawn a new sub-runtime process, if it can not be started the returned process has already exited
+func (s *supervisor) spawn() (*process, error) {
+	p := &process{
+		startedAt: time.Now(),
+		ready:     make(chan struct{}),
+		exited:    make(chan struct{}),
+	}
+
+	cmd, err := s.newCommand()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		p.cmd = &exec.Cmd{}
+		p.err = err
+		close(p.exited)
+	} else {
+		p.cmd = cmd
+		go func() {
+			p.err = cmd.Wait()
+			flushOutput(cmd)
+			close(p.exited)
+		}()
+		go s.awaitReadiness(p)
+	}
+
+	s.mu.Lock()
+	s.current = p
+	close(s.spawned)
+	s.spawned = make(chan struct{})
+	s.mu.Unlock()
+
+	return p, err
+}
+
+func (s *supervisor) run(p *process) {
+	backoff := s.policy.InitialBackoff
+	var crashes []time.Time
+
+	for {
+		err := p.wait()
+		if s.isStopping() {
+			s.finish(ErrorSubRuntimeStopped)
+			return
+		}
+
+		// Recycled processes are replaced right away, they did not crash
+		if s.isRecycling(p) {
+			if p, err = s.spawn(); err != nil {
+				s.logger.Errorf("Unable to restart forked function: %v", err)
+			}
+			if s.isStopping() {
+				p.signal(syscall.SIGTERM)
+			}
+			continue
+		}
+
+		atomic.AddUint64(&s.crashes, 1)
+		now := time.Now()
+		if now.Sub(p.startedAt) >= s.policy.CrashWindow {
+			backoff = s.policy.InitialBackoff
+		}
+		crashes = recentCrashes(append(crashes, now), now.Add(-s.policy.CrashWindow))
+
+		if s.policy.MaxCrashes > 0 && len(crashes) > s.policy.MaxCrashes {
+			s.finish(fmt.Errorf("sub-runtime crashed %d times in %v, giving up: %v", len(crashes), s.policy.CrashWindow, err))
+			return
+		}
+
+		s.logger.Warnf("Forked function has terminated: %v, restarting in %v", err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-s.stop:
+			s.finish(ErrorSubRuntimeStopped)
+			return
+		}
+
+		backoff *= 2
+		if backoff > s.policy.MaxBackoff {
+			backoff = s.policy.MaxBackoff
+		}
+		if p, err = s.spawn(); err != nil {
+			s.logger.Errorf("Unable to restart forked function: %v", err)
+		}
+		// Supervisor may have been stopped while the new process was being spawned
+		if s.isStopping() {
+			p.signal(syscall.SIGTERM)
+		}
+	}
+}
+
+// awaitReadiness - probe the given process until it is ready to handle invocations, a process which
+// does not become ready within the startup timeout is killed, and restarted as if it crashed
+func (s *supervisor) awaitReadiness(p *process) {
+	if s.probe == nil {
+		s.markReady(p)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.startupTimeout)
+	defer cancel()
+
+	for {
+		if err := s.probe(ctx); err == nil {
+			s.logger.Infof("Forked function is ready, started in %v", time.Since(p.startedAt))
+			s.markReady(p)
+			return
+		}
+
+		select {
+		case <-time.After(probeInterval):
+		case <-p.exited:
+			return
+		case <-ctx.Done():
+			s.logger.Errorf("Forked function did not become ready within %v, killing it", s.startupTimeout)
+			p.signal(syscall.SIGKILL)
+			return
+		}
+	}
+}
+
+func (s *supervisor) markReady(p *process) {
+	close(p.ready)
+	if s.onReady != nil {
+		s.onReady(p)
+	}
+}
+
+// ready - wait for a sub-runtime process ready to handle invocations, across restarts
+func (s *supervisor) ready(ctx context.Context) (*process, error) {
+	for {
+		s.mu.Lock()
+		p, spawned := s.current, s.spawned
+		s.mu.Unlock()
+
+		// Once a process has exited, only a new process can become ready
+		ready := p.ready
+		if p.hasExited() {
+			ready = nil
+		}
+
+		select {
+		case <-ready:
+			return p, nil
+		case <-spawned:
+		case <-s.done:
+			return nil, s.failure()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// recentCrashes - only keep crashes that happened after the given time
+func recentCrashes(crashes []time.Time, since time.Time) []time.Time {
+	for len(crashes) > 0 && crashes[0].Before(since) {
+		crashes = crashes[1:]
+	}
+	return crashes
+}
+
+func (s *supervisor) finish(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	close(s.done)
+}
+
+func (s *supervisor) isStopping() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopping
+}
+
+// running - currently running (or last crashed) sub-runtime process
+func (s *supervisor) running() *process {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+// terminate - stop supervising and send SIGTERM to the running sub-runtime process
+func (s *supervisor) terminate() {
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		return
+	}
+	s.stopping = true
+	close(s.stop)
+	p := s.current
+	s.mu.Unlock()
+
+	if p != nil {
+		p.signal(syscall.SIGTERM)
+	}
+}
+
+// recycle - replace the given process by a new one once it terminated, it is killed if it does not terminate
+// within the given timeout after SIGTERM, returns false if the process is not running anymore or the supervisor
+// is stopping, nothing is then done
+func (s *supervisor) recycle(p *process, timeout time.Duration) bool {
+	s.mu.Lock()
+	if s.stopping || s.current != p {
+		s.mu.Unlock()
+		return false
+	}
+	s.recycling = p
+	s.mu.Unlock()
+
+	p.signal(syscall.SIGTERM)
+	go func() {
+		select {
+		case <-p.exited:
+		case <-time.After(timeout):
+			p.signal(syscall.SIGKILL)
+		}
+	}()
+	return true
+}
+
+func (s *supervisor) isRecycling(p *process) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recycling == p
+}
+
+// kill - send SIGKILL to the running sub-runtime process, used when it does not terminate in time
+func (s *supervisor) kill() {
+	if p := s.running(); p != nil {
+		p.signal(syscall.SIGKILL)
+	}
+}
+
+func (s *supervisor) failure() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
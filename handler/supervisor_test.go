@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+var fixtureRestartPolicy = RestartPolicy{
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+	MaxCrashes:     2,
+	CrashWindow:    time.Minute,
+}
+
+func newTestSupervisor(name string, args ...string) *supervisor {
+	return newSupervisor(func() (*exec.Cmd, error) {
+		return exec.Command(name, args...), nil
+	}, nil, 0, fixtureRestartPolicy)
+}
+
+func waitDone(t *testing.T, s *supervisor) {
+	select {
+	case <-s.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervisor did not terminate in time")
+	}
+}
+
+// waitFile - wait until a process of a test created the given file
+func waitFile(t *testing.T, path string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was not created in time", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	t.Run("gives up after too many crashes", func(t *testing.T) {
+		s := newTestSupervisor("sh", "-c", "exit 1")
+		if err := s.start(); err != nil {
+			t.Fatalf("start(), received error %v", err)
+		}
+		waitDone(t, s)
+
+		if crashes := atomic.LoadUint64(&s.crashes); crashes != 3 {
+			t.Errorf("crashes = %d, expected 3", crashes)
+		}
+		if s.failure() == nil || s.failure() == ErrorSubRuntimeStopped {
+			t.Errorf("failure() = %v, expected crash loop error", s.failure())
+		}
+	})
+
+	t.Run("stopped process is not restarted", func(t *testing.T) {
+		s := newTestSupervisor("sleep", "10")
+		if err := s.start(); err != nil {
+			t.Fatalf("start(), received error %v", err)
+		}
+		p := s.running()
+		s.terminate()
+		waitDone(t, s)
+
+		if crashes := atomic.LoadUint64(&s.crashes); crashes != 0 {
+			t.Errorf("crashes = %d, expected 0", crashes)
+		}
+		if s.failure() != ErrorSubRuntimeStopped {
+			t.Errorf("failure() = %v, expected %v", s.failure(), ErrorSubRuntimeStopped)
+		}
+		if !p.hasExited() {
+			t.Error("stopped process should have exited")
+		}
+	})
+
+	t.Run("recycles only the running process", func(t *testing.T) {
+		s := newTestSupervisor("sleep", "10")
+		if err := s.start(); err != nil {
+			t.Fatalf("start(), received error %v", err)
+		}
+		p := s.running()
+		if !s.recycle(p, time.Second) {
+			t.Fatal("recycle() = false, expected the running process to be recycled")
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for s.running() == p {
+			if time.Now().After(deadline) {
+				t.Fatal("recycled process was not replaced")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if s.recycle(p, time.Second) {
+			t.Error("recycle() = true, expected the replaced process to be ignored")
+		}
+
+		s.terminate()
+		waitDone(t, s)
+		if s.recycle(s.running(), time.Second) {
+			t.Error("recycle() = true, expected nothing to be recycled once stopping")
+		}
+	})
+
+	t.Run("kills recycled processes ignoring SIGTERM", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "scw-supervisor")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		trapped := filepath.Join(dir, "trapped")
+
+		// Replacements ignore SIGTERM as well, they are killed once the test completes
+		s := newTestSupervisor("sh", "-c", "trap '' TERM; touch "+trapped+"; exec sleep 10")
+		if err := s.start(); err != nil {
+			t.Fatalf("start(), received error %v", err)
+		}
+		defer func() {
+			s.terminate()
+			s.kill()
+			waitDone(t, s)
+		}()
+
+		waitFile(t, trapped)
+		os.Remove(trapped)
+		p := s.running()
+		if !s.recycle(p, 50*time.Millisecond) {
+			t.Fatal("recycle() = false, expected the running process to be recycled")
+		}
+		select {
+		case <-p.exited:
+		case <-time.After(5 * time.Second):
+			t.Fatal("recycled process was not killed after the timeout")
+		}
+		if status, ok := p.cmd.ProcessState.Sys().(syscall.WaitStatus); !ok || status.Signal() != syscall.SIGKILL {
+			t.Errorf("recycled process terminated with %v, expected to be killed", p.err)
+		}
+		if crashes := atomic.LoadUint64(&s.crashes); crashes != 0 {
+			t.Errorf("crashes = %d, recycled process should not be counted as crashed", crashes)
+		}
+		// Wait for the replacement, so that it is the one killed once the test completes
+		waitFile(t, trapped)
+	})
+
+	t.Run("restarts processes which do not become ready in time", func(t *testing.T) {
+		s := newSupervisor(func() (*exec.Cmd, error) {
+			return exec.Command("sleep", "10"), nil
+		}, func(ctx context.Context) error {
+			return errors.New("not ready")
+		}, 50*time.Millisecond, RestartPolicy{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, CrashWindow: time.Minute})
+		if err := s.start(); err != nil {
+			t.Fatalf("start(), received error %v", err)
+		}
+		defer waitDone(t, s)
+		defer s.terminate()
+
+		p := s.running()
+		select {
+		case <-p.exited:
+		case <-time.After(5 * time.Second):
+			t.Fatal("process was not killed after the startup timeout")
+		}
+		if p.isReady() {
+			t.Error("process should never have been ready")
+		}
+		if status, ok := p.cmd.ProcessState.Sys().(syscall.WaitStatus); !ok || status.Signal() != syscall.SIGKILL {
+			t.Errorf("process terminated with %v, expected to be killed", p.err)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for s.running() == p {
+			if time.Now().After(deadline) {
+				t.Fatal("process which did not become ready was not restarted")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if crashes := atomic.LoadUint64(&s.crashes); crashes == 0 {
+			t.Error("crashes = 0, expected the process to be counted as crashed")
+		}
+	})
+
+	t.Run("binary not found", func(t *testing.T) {
+		s := newTestSupervisor("/does/not/exist")
+		if err := s.start(); err == nil {
+			t.Error("start(), expected error")
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// unixScheme - scheme of upstream URLs designating a Unix socket, e.g. unix:///run/scw/upstream.sock
+	unixScheme = "unix://"
+	// DefaultFallbackUpstreamURL - TCP URL used by sub-runtimes which do not support Unix sockets, when none is configured
+	DefaultFallbackUpstreamURL = "http://127.0.0.1:8081"
+)
+
+// isUnixSocket - whether the given upstream URL designates a Unix socket
+func isUnixSocket(upstreamURL string) bool {
+	return strings.HasPrefix(upstreamURL, unixScheme)
+}
+
+// workerSocket - path of the Unix socket of the worker with the given index, the first worker listens on the given
+// path, others on the same path suffixed by their index (e.g. /run/scw/upstream-1.sock)
+func workerSocket(socketPath string, index int) string {
+	if index == 0 {
+		return socketPath
+	}
+	extension := filepath.Ext(socketPath)
+	return strings.TrimSuffix(socketPath, extension) + "-" + strconv.Itoa(index) + extension
+}
+
+// prepareSocket - create the directory of the given socket, and remove the socket left by a previous process
+func prepareSocket(socketPath string) error {
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0700); err != nil {
+		return err
+	}
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// newSocketClient - HTTP client sending every request to the given Unix socket, whatever the host of its URL
+func newSocketClient(socketPath string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+}
+
+// client - HTTP client reaching the running process of the worker, over its Unix socket if it listens on it,
+// over TCP otherwise
+func (w *worker) client() *http.Client {
+	if atomic.LoadInt32(&w.overSocket) == 1 {
+		return w.socketClient
+	}
+	return w.tcpClient
+}
+
+// setOverSocket - whether the running process of the worker listens on its Unix socket, rather than over TCP
+func (w *worker) setOverSocket(overSocket bool) {
+	var value int32
+	if overSocket {
+		value = 1
+	}
+	atomic.StoreInt32(&w.overSocket, value)
+}
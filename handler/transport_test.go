@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWorkerSocket(t *testing.T) {
+	tests := []struct {
+		socketPath string
+		index      int
+		expected   string
+	}{
+		{"/run/scw/upstream.sock", 0, "/run/scw/upstream.sock"},
+		{"/run/scw/upstream.sock", 2, "/run/scw/upstream-2.sock"},
+		{"/run/scw/upstream", 1, "/run/scw/upstream-1"},
+	}
+
+	for _, test := range tests {
+		if socketPath := workerSocket(test.socketPath, test.index); socketPath != test.expected {
+			t.Errorf("workerSocket(%s, %d) = %s, expected %s", test.socketPath, test.index, socketPath, test.expected)
+		}
+	}
+}
+
+func TestProbeTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scw-socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpListener.Close()
+
+	fn := &FunctionInvoker{client: &http.Client{}}
+	socketPath := filepath.Join(dir, "upstream.sock")
+	w := &worker{
+		upstreamURL:  "http://" + tcpListener.Addr().String(),
+		socketPath:   socketPath,
+		tcpClient:    fn.client,
+		socketClient: newSocketClient(socketPath),
+	}
+
+	t.Run("falls back to TCP", func(t *testing.T) {
+		if err := fn.probe(context.Background(), w); err != nil {
+			t.Fatalf("probe(), received error %v", err)
+		}
+		if w.client() != w.tcpClient {
+			t.Error("client() should reach the worker over TCP")
+		}
+	})
+
+	t.Run("uses Unix socket", func(t *testing.T) {
+		socketListener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer socketListener.Close()
+
+		if err := fn.probe(context.Background(), w); err != nil {
+			t.Fatalf("probe(), received error %v", err)
+		}
+		if atomic.LoadInt32(&w.overSocket) != 1 || w.client() != w.socketClient {
+			t.Error("client() should reach the worker over its Unix socket")
+		}
+	})
+}
@@ -1,10 +1,13 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net/http"
+
+	"github.com/scaleway/functions-runtime/events"
 )
 
 var (
@@ -17,10 +20,19 @@ type ResponseHTTP struct {
 	Body            json.RawMessage   `json:"body"`
 	Headers         map[string]string `json:"headers"`
 	IsBase64Encoded bool              `json:"isBase64Encoded"`
+	// Cookies - cookies to set, sent as Set-Cookie headers, only with payload format 2.0
+	Cookies []string `json:"cookies"`
 }
 
 // GetResponse - Transform a response string into an HTTP Response structure
 func GetResponse(response io.Reader) (*ResponseHTTP, error) {
+	return GetResponseFormat(response, events.EventFormatV1)
+}
+
+// GetResponseFormat - Transform a response string into an HTTP Response structure, of the given payload format:
+// with payload format 2.0, handlers may also return cookies, and a response which is valid JSON without status
+// code is sent as the JSON body of a 200 response
+func GetResponseFormat(response io.Reader, format events.EventFormat) (*ResponseHTTP, error) {
 	handlerResponse := &ResponseHTTP{}
 
 	// Read body content
@@ -32,6 +44,19 @@ func GetResponse(response io.Reader) (*ResponseHTTP, error) {
 	unmarshalErr := json.Unmarshal(bodyBytes, &handlerResponse)
 
 	// If handler dit not return a JSON or status code, just use 200 OK
+	if format != events.EventFormatV2 {
+		handlerResponse.Cookies = nil
+	} else if unmarshalErr != nil || handlerResponse.StatusCode == nil {
+		// Simplified form: whatever the handler returned is the body, strings are sent without their quotes
+		handlerResponse = &ResponseHTTP{}
+		if trimmed := bytes.TrimSpace(bodyBytes); json.Valid(trimmed) {
+			if bytes.HasPrefix(trimmed, []byte(`"`)) {
+				bodyBytes = trimmed
+			} else {
+				handlerResponse.Headers = map[string]string{"Content-Type": "application/json"}
+			}
+		}
+	}
 	if unmarshalErr != nil || handlerResponse.StatusCode == nil {
 		handlerResponse.StatusCode = &httpStatusOK
 		handlerResponse.Body = bodyBytes
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/scaleway/functions-runtime/events"
+)
+
+func TestGetResponseFormat(t *testing.T) {
+	tests := []struct {
+		name            string
+		format          events.EventFormat
+		response        string
+		expectedStatus  int
+		expectedBody    string
+		expectedHeaders map[string]string
+		expectedCookies []string
+	}{
+		{"v1 response", events.EventFormatV1, `{"statusCode": 201, "body": "created", "headers": {"X-Custom": "a"}}`, 201, `"created"`, map[string]string{"X-Custom": "a"}, nil},
+		{"v1 cookies ignored", events.EventFormatV1, `{"statusCode": 200, "body": "ok", "cookies": ["a=b"]}`, 200, `"ok"`, nil, nil},
+		{"v1 raw body", events.EventFormatV1, `hello`, 200, `hello`, nil, nil},
+		{"v2 response with cookies", events.EventFormatV2, `{"statusCode": 200, "body": "ok", "cookies": ["a=b", "c=d"]}`, 200, `"ok"`, nil, []string{"a=b", "c=d"}},
+		{"v2 simplified object", events.EventFormatV2, `{"message": "hello"}`, 200, `{"message": "hello"}`, map[string]string{"Content-Type": "application/json"}, nil},
+		{"v2 simplified string", events.EventFormatV2, ` "hello"`, 200, `"hello"`, nil, nil},
+		{"v2 raw body", events.EventFormatV2, `hello`, 200, `hello`, nil, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := GetResponseFormat(strings.NewReader(test.response), test.format)
+			if err != nil {
+				t.Fatalf("GetResponseFormat(), received error %v", err)
+			}
+			if *response.StatusCode != test.expectedStatus || string(response.Body) != test.expectedBody {
+				t.Errorf("response = %d %s, expected %d %s", *response.StatusCode, response.Body, test.expectedStatus, test.expectedBody)
+			}
+			if !reflect.DeepEqual(response.Headers, test.expectedHeaders) || !reflect.DeepEqual(response.Cookies, test.expectedCookies) {
+				t.Errorf("headers = %v, cookies = %v, expected %v %v", response.Headers, response.Cookies, test.expectedHeaders, test.expectedCookies)
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+// Package logging implements the structured, leveled logger of the core runtime, writing entries as JSON or logfmt
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level - severity of a log entry
+type Level int
+
+// Log levels, from the most verbose to the most severe
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel - parse a level name (e.g. "info", "WARNING"), returns false if it is unknown
+func ParseLevel(name string) (Level, bool) {
+	switch strings.ToLower(name) {
+	case "debug", "trace":
+		return LevelDebug, true
+	case "info", "notice":
+		return LevelInfo, true
+	case "warn", "warning":
+		return LevelWarn, true
+	case "error", "err", "fatal", "critical", "panic":
+		return LevelError, true
+	}
+	return LevelInfo, false
+}
+
+// Format - encoding of log entries
+type Format string
+
+// Supported formats
+const (
+	FormatJSON   Format = "json"
+	FormatLogfmt Format = "logfmt"
+)
+
+// ParseFormat - parse a format name, returns false if it is unknown
+func ParseFormat(name string) (Format, bool) {
+	switch Format(strings.ToLower(name)) {
+	case FormatJSON:
+		return FormatJSON, true
+	case FormatLogfmt:
+		return FormatLogfmt, true
+	}
+	return FormatJSON, false
+}
+
+// Fields - additional data attached to log entries
+type Fields map[string]interface{}
+
+// Keys of the log schema, time, level and message are written first in every entry, in this order
+const (
+	KeyTime            = "time"
+	KeyLevel           = "level"
+	KeyMessage         = "msg"
+	KeyFunctionName    = "function_name"
+	KeyFunctionVersion = "function_version"
+	KeyInvocationID    = "invocation_id"
+	// KeyStream - output stream of user code ("stdout" or "stderr") an entry comes from, absent for core runtime entries
+	KeyStream = "stream"
+	// KeyWorker - index of the sub-runtime worker process an entry comes from
+	KeyWorker = "worker"
+)
+
+// outputMu - serialize writes of all loggers, so that entries are never interleaved
+var outputMu sync.Mutex
+
+// Logger - writes leveled log entries with a set of fields
+type Logger struct {
+	output io.Writer
+	format Format
+	level  Level
+	fields Fields
+}
+
+// New - create a logger writing entries of at least the given level to output
+func New(output io.Writer, format Format, level Level) *Logger {
+	return &Logger{output: output, format: format, level: level, fields: Fields{}}
+}
+
+// With - logger adding the given field to all its entries
+func (l *Logger) With(key string, value interface{}) *Logger {
+	return l.WithFields(Fields{key: value})
+}
+
+// WithFields - logger adding the given fields to all its entries
+func (l *Logger) WithFields(fields Fields) *Logger {
+	child := *l
+	child.fields = make(Fields, len(l.fields)+len(fields))
+	for key, value := range l.fields {
+		child.fields[key] = value
+	}
+	for key, value := range fields {
+		child.fields[key] = value
+	}
+	return &child
+}
+
+// WithOutput - logger writing its entries to another output
+func (l *Logger) WithOutput(output io.Writer) *Logger {
+	child := *l
+	child.output = output
+	return &child
+}
+
+// Enabled - whether entries of the given level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+// Log - write an entry with the given level, message and additional fields
+func (l *Logger) Log(level Level, msg string, fields Fields) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.write(level, msg, fields)
+}
+
+// write - write an entry whatever its level
+func (l *Logger) write(level Level, msg string, fields Fields) {
+	entry := make(Fields, len(l.fields)+len(fields))
+	for key, value := range fields {
+		entry[key] = value
+	}
+	// Fields of the logger (e.g. function name, invocation ID) can not be overridden
+	for key, value := range l.fields {
+		entry[key] = value
+	}
+
+	var buffer bytes.Buffer
+	if l.format == FormatLogfmt {
+		encodeLogfmt(&buffer, time.Now(), level, msg, entry)
+	} else {
+		encodeJSON(&buffer, time.Now(), level, msg, entry)
+	}
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	l.output.Write(buffer.Bytes())
+}
+
+// LogOutput - write a line of output of user code, lines holding a JSON object are merged into the entry
+// instead of being encoded as a message: their "msg" (or "message") and "level" fields are used if present.
+// Only lines with a level are filtered by the level of the logger, other lines (e.g. stack traces) are always
+// written, with the given default level
+func (l *Logger) LogOutput(defaultLevel Level, line []byte) {
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		l.write(defaultLevel, string(line), nil)
+		return
+	}
+
+	var fields Fields
+	if err := json.Unmarshal(trimmed, &fields); err != nil {
+		l.write(defaultLevel, string(line), nil)
+		return
+	}
+
+	level, leveled := defaultLevel, false
+	for _, key := range []string{"level", "severity", "levelname"} {
+		if name, ok := fields[key].(string); ok {
+			if parsed, ok := ParseLevel(name); ok {
+				level, leveled = parsed, true
+				delete(fields, key)
+				break
+			}
+		}
+	}
+	if leveled && !l.Enabled(level) {
+		return
+	}
+
+	msg := ""
+	for _, key := range []string{"msg", "message"} {
+		if value, ok := fields[key].(string); ok {
+			msg = value
+			delete(fields, key)
+			break
+		}
+	}
+	delete(fields, KeyTime)
+
+	l.write(level, msg, fields)
+}
+
+// Debugf - write a debug entry
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.Log(LevelDebug, fmt.Sprintf(format, args...), nil)
+}
+
+// Infof - write an info entry
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.Log(LevelInfo, fmt.Sprintf(format, args...), nil)
+}
+
+// Warnf - write a warning entry
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.Log(LevelWarn, fmt.Sprintf(format, args...), nil)
+}
+
+// Errorf - write an error entry
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.Log(LevelError, fmt.Sprintf(format, args...), nil)
+}
+
+var (
+	defaultLoggerMu sync.RWMutex
+	defaultLogger   = New(os.Stderr, FormatJSON, LevelInfo)
+)
+
+// SetDefault - set the logger used by package-level functions
+func SetDefault(logger *Logger) {
+	defaultLoggerMu.Lock()
+	defer defaultLoggerMu.Unlock()
+	defaultLogger = logger
+}
+
+// Default - logger used by package-level functions
+func Default() *Logger {
+	defaultLoggerMu.RLock()
+	defer defaultLoggerMu.RUnlock()
+	return defaultLogger
+}
+
+// Debugf - write a debug entry with the default logger
+func Debugf(format string, args ...interface{}) {
+	Default().Debugf(format, args...)
+}
+
+// Infof - write an info entry with the default logger
+func Infof(format string, args ...interface{}) {
+	Default().Infof(format, args...)
+}
+
+// Warnf - write a warning entry with the default logger
+func Warnf(format string, args ...interface{}) {
+	Default().Warnf(format, args...)
+}
+
+// Errorf - write an error entry with the default logger
+func Errorf(format string, args ...interface{}) {
+	Default().Errorf(format, args...)
+}
+
+// ==== Encoding ==== //
+
+func sortedKeys(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		if key != KeyTime && key != KeyLevel && key != KeyMessage {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func encodeJSON(buffer *bytes.Buffer, t time.Time, level Level, msg string, fields Fields) {
+	buffer.WriteString(`{"` + KeyTime + `":`)
+	writeJSON(buffer, t.UTC().Format(time.RFC3339Nano))
+	buffer.WriteString(`,"` + KeyLevel + `":`)
+	writeJSON(buffer, level.String())
+	buffer.WriteString(`,"` + KeyMessage + `":`)
+	writeJSON(buffer, msg)
+
+	for _, key := range sortedKeys(fields) {
+		buffer.WriteByte(',')
+		writeJSON(buffer, key)
+		buffer.WriteByte(':')
+		writeJSON(buffer, fields[key])
+	}
+	buffer.WriteString("}\n")
+}
+
+func writeJSON(buffer *bytes.Buffer, value interface{}) {
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buffer.Write(encoded)
+}
+
+func encodeLogfmt(buffer *bytes.Buffer, t time.Time, level Level, msg string, fields Fields) {
+	buffer.WriteString(KeyTime + "=" + t.UTC().Format(time.RFC3339Nano))
+	buffer.WriteString(" " + KeyLevel + "=" + level.String())
+	buffer.WriteString(" " + KeyMessage + "=" + logfmtValue(msg))
+
+	for _, key := range sortedKeys(fields) {
+		buffer.WriteString(" " + key + "=" + logfmtValue(fields[key]))
+	}
+	buffer.WriteByte('\n')
+}
+
+func logfmtValue(value interface{}) string {
+	var s string
+	switch typed := value.(type) {
+	case string:
+		s = typed
+	case error:
+		s = typed.Error()
+	case fmt.Stringer:
+		s = typed.String()
+	case bool, int, int64, uint64, float64:
+		s = fmt.Sprint(typed)
+	default:
+		encoded, err := json.Marshal(typed)
+		if err != nil {
+			encoded = []byte(fmt.Sprint(typed))
+		}
+		s = string(encoded)
+	}
+
+	if s == "" || strings.ContainsAny(s, " =\"\\\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
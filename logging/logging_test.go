@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func decodeEntry(t *testing.T, buffer *bytes.Buffer) map[string]interface{} {
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &entry); err != nil {
+		t.Fatalf("entry %q is not valid JSON: %v", buffer.String(), err)
+	}
+	return entry
+}
+
+func TestLoggerJSON(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := New(&buffer, FormatJSON, LevelInfo).With(KeyFunctionName, "my-function")
+
+	logger.Debugf("not written")
+	if buffer.Len() != 0 {
+		t.Fatalf("debug entry written with info level: %s", buffer.String())
+	}
+
+	logger.Log(LevelWarn, "hello", Fields{"count": 2, KeyFunctionName: "overridden"})
+	entry := decodeEntry(t, &buffer)
+
+	if entry[KeyLevel] != "warn" || entry[KeyMessage] != "hello" || entry["count"] != float64(2) {
+		t.Errorf("unexpected entry %v", entry)
+	}
+	if entry[KeyFunctionName] != "my-function" {
+		t.Errorf("logger fields should not be overridden, got %v", entry[KeyFunctionName])
+	}
+	if !strings.HasPrefix(buffer.String(), `{"time":`) {
+		t.Errorf("entry should start with time, got %s", buffer.String())
+	}
+}
+
+func TestLoggerLogfmt(t *testing.T) {
+	var buffer bytes.Buffer
+	New(&buffer, FormatLogfmt, LevelDebug).Log(LevelInfo, "hello world", Fields{"b": "x=y", "a": true, "c": map[string]int{"n": 1}})
+
+	line := buffer.String()
+	expected := ` level=info msg="hello world" a=true b="x=y" c="{\"n\":1}"` + "\n"
+	if !strings.HasPrefix(line, "time=") || !strings.HasSuffix(line, expected) {
+		t.Errorf("got %q, expected suffix %q", line, expected)
+	}
+}
+
+func TestLogOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		level    string
+		msg      string
+		extraKey string
+	}{
+		{"plain text", "hello", "info", "hello", ""},
+		{"invalid JSON", "{hello", "info", "{hello", ""},
+		{"JSON object", `{"message": "hello", "level": "ERROR", "user": "abc"}`, "error", "hello", "user"},
+		{"JSON object with unknown level", `{"msg": "hello", "level": "custom"}`, "info", "hello", "level"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			New(&buffer, FormatJSON, LevelDebug).With(KeyStream, "stdout").LogOutput(LevelInfo, []byte(test.line))
+			entry := decodeEntry(t, &buffer)
+
+			if entry[KeyLevel] != test.level || entry[KeyMessage] != test.msg || entry[KeyStream] != "stdout" {
+				t.Errorf("unexpected entry %v", entry)
+			}
+			if _, ok := entry[test.extraKey]; test.extraKey != "" && !ok {
+				t.Errorf("field %s of user output should be merged, got %v", test.extraKey, entry)
+			}
+		})
+	}
+}
+
+func TestLogOutputLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected bool
+	}{
+		{"plain text", "Traceback (most recent call last):", true},
+		{"JSON object without level", `{"msg": "hello"}`, true},
+		{"JSON object below level", `{"msg": "hello", "level": "info"}`, false},
+		{"JSON object at level", `{"msg": "hello", "level": "error"}`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			New(&buffer, FormatJSON, LevelError).LogOutput(LevelInfo, []byte(test.line))
+			if written := buffer.Len() > 0; written != test.expected {
+				t.Errorf("line written = %v, expected %v", written, test.expected)
+			}
+		})
+	}
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"os"
+
+	"github.com/scaleway/functions-runtime/logging"
 	"github.com/scaleway/functions-runtime/server"
-	"log"
 )
 
 func main() {
 	if err := server.Start(); err != nil {
-		log.Fatal(err)
+		logging.Errorf("%v", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,301 @@
+// Package metrics implements a minimal set of Prometheus metrics (counters, gauges and histograms),
+// exposed with the Prometheus text format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DurationBuckets - Default histogram buckets for durations, in seconds
+var DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// ExponentialBuckets - count histogram buckets, starting at start, each bucket being factor times larger than the previous one
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// metric - a metric family written in Prometheus text format
+type metric interface {
+	write(w io.Writer) error
+}
+
+// Registry - set of metrics exposed together
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// NewRegistry - create an empty metrics registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// Write - write all registered metrics in Prometheus text format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	for _, m := range metrics {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler - HTTP handler exposing all registered metrics
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		r.Write(w)
+	})
+}
+
+// family - name, description and labels shared by all series of a metric
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (f *family) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.kind)
+	return err
+}
+
+// key - identify a series by its label values
+func (f *family) key(labelValues []string) string {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// formatLabels - format label pairs of a series, with optional extra pairs (e.g. histogram's "le")
+func (f *family) formatLabels(labelValues []string, extra ...string) string {
+	pairs := make([]string, 0, len(labelValues)+len(extra)/2)
+	for i, value := range labelValues {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, f.labels[i], escapeLabelValue(value)))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escapeLabelValue(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter - a monotonically increasing value, partitioned by labels
+type Counter struct {
+	family
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+// NewCounter - create and register a counter with the given labels
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		family: family{name: name, help: help, kind: "counter", labels: labels},
+		series: map[string]*counterSeries{},
+	}
+	r.register(c)
+	return c
+}
+
+// Inc - increment the counter for the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add - add the given value, which must not be negative, to the counter for the given label values
+func (c *Counter) Add(value float64, labelValues ...string) {
+	key := c.key(labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{labelValues: append([]string(nil), labelValues...)}
+		c.series[key] = s
+	}
+	s.value += value
+}
+
+func (c *Counter) write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.writeHeader(w); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", c.name, c.formatLabels(s.labelValues), formatValue(s.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// valueFunc - a metric without labels, whose value is read when metrics are collected
+type valueFunc struct {
+	family
+	value func() float64
+}
+
+// NewCounterFunc - create and register a counter whose value is read from the given function
+func (r *Registry) NewCounterFunc(name, help string, value func() float64) {
+	r.register(&valueFunc{family: family{name: name, help: help, kind: "counter"}, value: value})
+}
+
+// NewGaugeFunc - create and register a gauge whose value is read from the given function
+func (r *Registry) NewGaugeFunc(name, help string, value func() float64) {
+	r.register(&valueFunc{family: family{name: name, help: help, kind: "gauge"}, value: value})
+}
+
+func (v *valueFunc) write(w io.Writer) error {
+	if err := v.writeHeader(w); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", v.name, formatValue(v.value()))
+	return err
+}
+
+// Histogram - distribution of observed values in buckets, partitioned by labels
+type Histogram struct {
+	family
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// NewHistogram - create and register a histogram with the given upper bounds of buckets (sorted) and labels
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		family:  family{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		series:  map[string]*histogramSeries{},
+	}
+	r.register(h)
+	return h
+}
+
+// Observe - add an observation to the histogram for the given label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labelValues: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, upperBound := range h.buckets {
+		if value <= upperBound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.writeHeader(w); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, upperBound := range h.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.formatLabels(s.labelValues, "le", formatValue(upperBound)), s.counts[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.name, h.formatLabels(s.labelValues, "le", "+Inf"), s.count,
+			h.name, h.formatLabels(s.labelValues), formatValue(s.sum),
+			h.name, h.formatLabels(s.labelValues), s.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(series interface{}) []string {
+	var keys []string
+	switch s := series.(type) {
+	case map[string]*counterSeries:
+		for key := range s {
+			keys = append(keys, key)
+		}
+	case map[string]*histogramSeries:
+		for key := range s {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	registry := NewRegistry()
+
+	counter := registry.NewCounter("test_invocations_total", "Number of invocations", "trigger", "status")
+	counter.Inc("http", "200")
+	counter.Inc("http", "200")
+	counter.Add(3, "mqtt", `"quoted"`)
+
+	registry.NewGaugeFunc("test_temperature", "Current temperature\nin celsius", func() float64 {
+		return 21.5
+	})
+
+	histogram := registry.NewHistogram("test_duration_seconds", "Duration", []float64{0.1, 1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(2)
+
+	var buffer bytes.Buffer
+	if err := registry.Write(&buffer); err != nil {
+		t.Fatalf("Write(), received error %v", err)
+	}
+
+	expected := `# HELP test_invocations_total Number of invocations
+# TYPE test_invocations_total counter
+test_invocations_total{trigger="http",status="200"} 2
+test_invocations_total{trigger="mqtt",status="\"quoted\""} 3
+# HELP test_temperature Current temperature\nin celsius
+# TYPE test_temperature gauge
+test_temperature 21.5
+# HELP test_duration_seconds Duration
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{le="0.1"} 1
+test_duration_seconds_bucket{le="1"} 2
+test_duration_seconds_bucket{le="+Inf"} 3
+test_duration_seconds_sum 2.55
+test_duration_seconds_count 3
+`
+	if buffer.String() != expected {
+		t.Errorf("Write(), got:\n%s\nexpected:\n%s", buffer.String(), expected)
+	}
+}
+
+func TestCounterInvalidLabels(t *testing.T) {
+	counter := NewRegistry().NewCounter("test_total", "Test", "label")
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc() with missing label values should panic")
+		}
+	}()
+	counter.Inc()
+}
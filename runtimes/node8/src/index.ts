@@ -61,8 +61,12 @@ const functionGateway = async (req: express.Request, res: express.Response) => {
         return res.status(500).send('Provided Handler does not exist, or does not export methods properly.');
     }
 
+    // Remaining execution time before the function times out, based on the deadline set by the core runtime
+    const context = req.body.context;
+    context.getRemainingTimeInMillis = () => context.deadline ? Math.max(context.deadline - Date.now(), 0) : undefined;
+
     try {
-        const functionResult = await handler(req.body.event, req.body.context, callback);
+        const functionResult = await handler(req.body.event, context, callback);
         // Response has been sent via Callback
         if (responseSent) return;
         return handleResponse(res, functionResult);
@@ -71,11 +75,19 @@ const functionGateway = async (req: express.Request, res: express.Response) => {
     }
 };
 
+// Readiness probes of the core runtime are answered once the server listens, rather than running the handler
+const healthPath = process.env.SCW_UPSTREAM_HEALTH_PATH;
+if (healthPath) {
+    app.get(healthPath, (req: express.Request, res: express.Response) => res.sendStatus(200));
+}
+
 app.all('/*', functionGateway);
 
 
+// Listen on the Unix socket provided by the core runtime if any, on the upstream port otherwise
+const socket = process.env.SCW_UPSTREAM_SOCKET;
 const port = process.env.SCW_UPSTREAM_PORT || 8081;
 
-app.listen(port, () => {
-    console.log(`Scaleway Node.js listening on port: ${port}`)
+app.listen(socket || port, () => {
+    console.log(`Scaleway Node.js listening on ${socket ? `socket: ${socket}` : `port: ${port}`}`)
 });
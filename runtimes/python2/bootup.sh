@@ -1,3 +1,9 @@
 # Script should be in the same directory as the bootup
 SCRIPT_DIR=$(dirname "$0")
-gunicorn --bind "127.0.0.1:$SCW_UPSTREAM_PORT" --error-logfile "-" --access-logfile "-" --chdir $SCRIPT_DIR index:app
\ No newline at end of file
+# Listen on the Unix socket provided by the core runtime if any, on the upstream port otherwise
+if [ -n "$SCW_UPSTREAM_SOCKET" ]; then
+  BIND="unix:$SCW_UPSTREAM_SOCKET"
+else
+  BIND="127.0.0.1:$SCW_UPSTREAM_PORT"
+fi
+gunicorn --bind "$BIND" --error-logfile "-" --access-logfile "-" --chdir $SCRIPT_DIR index:app
\ No newline at end of file
@@ -1,7 +1,9 @@
 from flask import Flask, request, jsonify
 from importlib import import_module
 import json
+import os
 import sys
+import time
 
 def import_function_handler(file_path, handler_name):
     split_module_path = file_path.split('/')
@@ -20,8 +22,23 @@ def import_function_handler(file_path, handler_name):
         # Raise exception with custom error message for UX
         raise Exception('Function Handler does not exist, check that you provided the right HANDLER parameter (path to your module with exported function to use), check your function logs')
 
+class Context(dict):
+    """Execution context of the function, with helpers available to the handler"""
+
+    def get_remaining_time_in_millis(self):
+        """Remaining execution time before the function times out, based on the deadline set by the core runtime"""
+        deadline = self.get('deadline')
+        if deadline is None:
+            return None
+        return max(int(deadline - time.time() * 1000), 0)
+
 app = Flask(__name__)
 
+# Readiness probes of the core runtime are answered once the server listens, rather than running the handler
+health_path = os.environ.get("SCW_UPSTREAM_HEALTH_PATH")
+if health_path:
+    app.add_url_rule(health_path, "health", lambda: ("", 200), methods=["GET"])
+
 @app.route("/", defaults={"path": ""}, methods=["POST"])
 @app.route("/<path:path>", methods=["POST"])
 def main_route(path):
@@ -29,7 +46,7 @@ def main_route(path):
     body = json.loads(request.get_data())
     try:
         function_handler = import_function_handler(body.get('handlerPath'), body.get('handlerName'))
-        function_result = function_handler(body.get('event'), body.get('context'))
+        function_result = function_handler(body.get('event'), Context(body.get('context') or {}))
     except Exception as e:
         return str(e), 500
 
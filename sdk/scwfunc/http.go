@@ -0,0 +1,91 @@
+package scwfunc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	// defaultUpstreamPort - port the core runtime reaches the function on, when none is provided
+	defaultUpstreamPort = "8081"
+	// streamContentType - content type of invocations followed by their streamed request body, on the line after them
+	streamContentType = "application/vnd.scw.invocation-stream"
+)
+
+// serveHTTP - serve invocations over HTTP, on the Unix socket provided by the core runtime if any,
+// on the upstream port otherwise
+func serveHTTP(handler EventHandler) error {
+	var listener net.Listener
+	var err error
+	if socket := os.Getenv("SCW_UPSTREAM_SOCKET"); socket != "" {
+		listener, err = net.Listen("unix", socket)
+	} else {
+		port := os.Getenv("SCW_UPSTREAM_PORT")
+		if port == "" {
+			port = defaultUpstreamPort
+		}
+		listener, err = net.Listen("tcp", "127.0.0.1:"+port)
+	}
+	if err != nil {
+		return err
+	}
+
+	return http.Serve(listener, httpHandler(handler))
+}
+
+// httpHandler - answer invocations sent by the core runtime with the response of the handler, errors of the
+// handler are answered with a 500 holding their message
+func httpHandler(handler EventHandler) http.Handler {
+	textContentTypes := textContentTypesFromEnv()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			// Health checks of the core runtime
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var requestBody []byte
+		if r.Header.Get("Content-Type") == streamContentType {
+			separator := bytes.IndexByte(body, '\n')
+			if separator < 0 {
+				http.Error(w, ErrorInvalidInvocation.Error(), http.StatusBadRequest)
+				return
+			}
+			body, requestBody = body[:separator], body[separator+1:]
+		}
+
+		response, err := invokeWithBody(r.Context(), handler, body, requestBody, textContentTypes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(response)
+	})
+}
+
+// textContentTypesFromEnv - media types of streamed request bodies passed as text, configured on the core runtime
+// by SCW_TEXT_CONTENT_TYPES, nil for the default ones
+func textContentTypesFromEnv() []string {
+	value, ok := os.LookupEnv("SCW_TEXT_CONTENT_TYPES")
+	if !ok {
+		return nil
+	}
+	types := []string{}
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			types = append(types, element)
+		}
+	}
+	return types
+}
@@ -0,0 +1,252 @@
+// Package scwfunc runs Go function handlers on the Scaleway Functions core runtime.
+//
+// A function is a binary (SCW_HANDLER_IS_BINARY=true) calling Start with its handler:
+//
+//	func handle(ctx context.Context, request events.APIGatewayProxyRequest, executionContext events.ExecutionContext) (scwfunc.Response, error) {
+//		return scwfunc.Response{StatusCode: http.StatusOK, Body: "Hello " + request.Path}, nil
+//	}
+//
+//	func main() {
+//		scwfunc.Start(handle)
+//	}
+//
+// Functions with triggers other than HTTP (e.g. cron, or CloudEvents) call StartEvent instead, with an EventHandler receiving the
+// JSON event of invocations as it is.
+//
+// When the core runtime sends HTTP events in payload format 2.0 (SCW_EVENT_FORMAT=2.0), functions call StartV2 with a
+// HandlerV2 receiving an events.APIGatewayV2HTTPRequest: the path and method of the request are then in RawPath and
+// RequestContext.HTTP, header names are lower-cased (e.g. content-type), and cookies are in Cookies. Their responses
+// may set Cookies. Invocations whose event is not in the payload format of the handler fail with ErrorEventFormat.
+//
+// Start speaks the protocol configured on the core runtime, over HTTP on the upstream port or Unix socket, or over
+// the standard input and output (SCW_RUNTIME_PROTOCOL=stdio).
+package scwfunc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/scaleway/functions-runtime/events"
+)
+
+// Handler - function handler of HTTP triggers, called for every invocation
+// Invocations from triggers whose payload is not a JSON object (e.g. MQTT) carry their payload in the Body of the
+// request, with an empty HTTPMethod. Cron events and CloudEvents can not be decoded as HTTP requests, functions with
+// such triggers must be started with an EventHandler. Responses are ignored for triggers other than HTTP. The given
+// context is cancelled once the deadline of the invocation is exceeded, or when the core runtime aborts the
+// invocation.
+type Handler func(ctx context.Context, request events.APIGatewayProxyRequest, executionContext events.ExecutionContext) (Response, error)
+
+// HandlerV2 - function handler of HTTP triggers whose events are in payload format 2.0, called for every invocation
+// Invocations from other triggers are handled as with Handler.
+type HandlerV2 func(ctx context.Context, request events.APIGatewayV2HTTPRequest, executionContext events.ExecutionContext) (Response, error)
+
+// EventHandler - function handler receiving the JSON event of invocations as it is, to handle every trigger
+// Events of HTTP triggers decode into events.APIGatewayProxyRequest, events of cron triggers into events.CronEvent,
+// and payloads of other triggers are JSON strings, unless the core runtime formats them as CloudEvents: they then
+// decode into events.CloudEvent, or into a slice of events.CloudEvent for batches. Responses are ignored for
+// triggers other than HTTP, and the context is cancelled as for Handler.
+type EventHandler func(ctx context.Context, event json.RawMessage, executionContext events.ExecutionContext) (Response, error)
+
+// Response - HTTP response of a function handler
+type Response struct {
+	// StatusCode - HTTP status code of the response, 200 if not set
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body"`
+	// IsBase64Encoded - whether Body is base64 encoded, it is then decoded before being sent to the caller,
+	// to return binary content
+	IsBase64Encoded bool `json:"isBase64Encoded,omitempty"`
+	// Cookies - cookies to set, sent as Set-Cookie headers, only with payload format 2.0
+	Cookies []string `json:"cookies,omitempty"`
+}
+
+var (
+	// ErrorInvalidInvocation - Error type for invocations which can not be decoded
+	ErrorInvalidInvocation = errors.New("invalid invocation request")
+	// ErrorEventFormat - Error type for HTTP events whose payload format is not the one of the handler, the function
+	// must be started with StartV2 when the core runtime sends events in payload format 2.0, and with Start otherwise
+	ErrorEventFormat = errors.New("HTTP event payload format does not match the handler, see SCW_EVENT_FORMAT")
+)
+
+// invocation - request sent by the core runtime for every invocation
+type invocation struct {
+	Event   json.RawMessage         `json:"event"`
+	Context events.ExecutionContext `json:"context"`
+}
+
+// Start - serve invocations with the given handler, until the core runtime terminates the function
+// It never returns, and exits the process with an error status if invocations can not be served.
+func Start(handler Handler) {
+	StartEvent(handler.handleEvent)
+}
+
+// StartV2 - serve invocations with the given handler of events in payload format 2.0, see Start
+func StartV2(handler HandlerV2) {
+	StartEvent(handler.handleEvent)
+}
+
+// StartEvent - serve invocations with the given event handler, see Start
+func StartEvent(handler EventHandler) {
+	var err error
+	if os.Getenv("SCW_RUNTIME_PROTOCOL") == "stdio" {
+		err = serveStdio(handler, os.Stdin, os.Stdout)
+	} else {
+		err = serveHTTP(handler)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scwfunc: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// handleEvent - call the handler with the event decoded as an HTTP request
+func (handler Handler) handleEvent(ctx context.Context, event json.RawMessage, executionContext events.ExecutionContext) (Response, error) {
+	var request events.APIGatewayProxyRequest
+	if err := decodeEvent(event, &request.Body, &request, events.EventFormatV1); err != nil {
+		return Response{}, err
+	}
+	return handler(ctx, request, executionContext)
+}
+
+// handleEvent - call the handler with the event decoded as an HTTP request in payload format 2.0
+func (handler HandlerV2) handleEvent(ctx context.Context, event json.RawMessage, executionContext events.ExecutionContext) (Response, error) {
+	var request events.APIGatewayV2HTTPRequest
+	if err := decodeEvent(event, &request.Body, &request, events.EventFormatV2); err != nil {
+		return Response{}, err
+	}
+	return handler(ctx, request, executionContext)
+}
+
+// decodeEvent - decode the payload of other triggers into body, and HTTP events into request when they are in the
+// given payload format, only events in payload format 2.0 hold their version
+func decodeEvent(event json.RawMessage, body *string, request interface{}, format events.EventFormat) error {
+	if len(event) > 0 && event[0] == '"' {
+		// Events of other triggers are forwarded as they are
+		if err := json.Unmarshal(event, body); err != nil {
+			return ErrorInvalidInvocation
+		}
+		return nil
+	} else if len(event) == 0 {
+		return nil
+	}
+
+	var version struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(event, &version); err != nil {
+		return ErrorInvalidInvocation
+	}
+	if (version.Version == string(events.EventFormatV2)) != (format == events.EventFormatV2) {
+		return ErrorEventFormat
+	}
+	if err := json.Unmarshal(event, request); err != nil {
+		return ErrorInvalidInvocation
+	}
+	return nil
+}
+
+// invoke - decode the given invocation request, call the handler and encode its response
+func invoke(ctx context.Context, handler EventHandler, body []byte) ([]byte, error) {
+	return invokeWithBody(ctx, handler, body, nil, nil)
+}
+
+// invokeWithBody - invoke the handler, with the given request body if not nil, when the core runtime streams
+// request bodies after invocations rather than in their event, bodies whose media type is not one of the given
+// text types are base64-encoded
+func invokeWithBody(ctx context.Context, handler EventHandler, body, requestBody []byte, textContentTypes []string) ([]byte, error) {
+	var request invocation
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, ErrorInvalidInvocation
+	}
+
+	event := request.Event
+	if requestBody != nil {
+		var err error
+		if event, err = withBody(event, requestBody, textContentTypes); err != nil {
+			return nil, ErrorInvalidInvocation
+		}
+	}
+
+	if request.Context.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.Unix(0, request.Context.Deadline*int64(time.Millisecond)))
+		defer cancel()
+	}
+
+	response, err := call(ctx, handler, event, request.Context)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == 0 {
+		response.StatusCode = http.StatusOK
+	}
+	return json.Marshal(response)
+}
+
+// withBody - add the streamed request body to the event it was left out of, as the body of HTTP events, the data
+// of binary mode CloudEvents, or as the event itself for other triggers, HTTP bodies and CloudEvent data which are
+// not text are base64-encoded as the core runtime does for bodies it does not stream
+func withBody(event json.RawMessage, body []byte, textContentTypes []string) (json.RawMessage, error) {
+	if len(event) == 0 || event[0] != '{' {
+		return json.Marshal(string(body))
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(event, &fields); err != nil {
+		return nil, err
+	}
+	if _, ok := fields["specversion"]; ok {
+		var cloudEvent events.CloudEvent
+		if err := json.Unmarshal(event, &cloudEvent); err != nil {
+			return nil, err
+		}
+		cloudEvent.SetData(body, textContentTypes)
+		return json.Marshal(cloudEvent)
+	}
+	var headers map[string]string
+	if raw, ok := fields["headers"]; ok {
+		if err := json.Unmarshal(raw, &headers); err != nil {
+			return nil, err
+		}
+	}
+	var contentType string
+	for name, value := range headers {
+		if strings.EqualFold(name, "Content-Type") {
+			contentType = value
+		}
+	}
+
+	encoded := string(body)
+	isBase64Encoded := len(body) > 0 && !events.IsTextBody(contentType, encoded, textContentTypes)
+	if isBase64Encoded {
+		encoded = base64.StdEncoding.EncodeToString(body)
+	}
+	var err error
+	if fields["body"], err = json.Marshal(encoded); err != nil {
+		return nil, err
+	}
+	if fields["isBase64Encoded"], err = json.Marshal(isBase64Encoded); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// call the handler, a panic is reported as the error of the invocation rather than terminating the function
+func call(ctx context.Context, handler EventHandler, event json.RawMessage, executionContext events.ExecutionContext) (response Response, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("handler panicked: %v", recovered)
+		}
+	}()
+	return handler(ctx, event, executionContext)
+}
@@ -0,0 +1,319 @@
+package scwfunc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scaleway/functions-runtime/events"
+	"github.com/scaleway/functions-runtime/framing"
+	"github.com/scaleway/functions-runtime/handler"
+)
+
+func echoHandler(ctx context.Context, request events.APIGatewayProxyRequest, executionContext events.ExecutionContext) (Response, error) {
+	switch request.Body {
+	case "fail":
+		return Response{}, errors.New("handler failed")
+	case "panic":
+		panic("handler panicked")
+	case "deadline":
+		<-ctx.Done()
+		return Response{Body: ctx.Err().Error()}, nil
+	}
+	return Response{
+		Headers: map[string]string{"X-Method": request.HTTPMethod},
+		Body:    request.Body + " " + executionContext.InvocationID,
+	}, nil
+}
+
+func TestInvoke(t *testing.T) {
+	deadline := time.Now().Add(10*time.Millisecond).UnixNano() / int64(time.Millisecond)
+	tests := []struct {
+		name         string
+		request      string
+		expected     Response
+		expectsError bool
+	}{
+		{
+			name:     "HTTP trigger",
+			request:  `{"event":{"httpMethod":"POST","body":"hello"},"context":{"invocationId":"abc"}}`,
+			expected: Response{StatusCode: http.StatusOK, Headers: map[string]string{"X-Method": "POST"}, Body: "hello abc"},
+		},
+		{
+			name:     "other trigger",
+			request:  `{"event":"hello","context":{"invocationId":"abc"}}`,
+			expected: Response{StatusCode: http.StatusOK, Headers: map[string]string{"X-Method": ""}, Body: "hello abc"},
+		},
+		{
+			name:     "context cancelled on deadline",
+			request:  `{"event":{"body":"deadline"},"context":{"deadline":` + strconv.FormatInt(deadline, 10) + `}}`,
+			expected: Response{StatusCode: http.StatusOK, Body: context.DeadlineExceeded.Error()},
+		},
+		{name: "handler error", request: `{"event":{"body":"fail"}}`, expectsError: true},
+		{name: "handler panic", request: `{"event":{"body":"panic"}}`, expectsError: true},
+		{name: "invalid request", request: `{"event":42}`, expectsError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := invoke(context.Background(), Handler(echoHandler).handleEvent, []byte(test.request))
+			if test.expectsError {
+				if err == nil {
+					t.Errorf("invoke(), expected an error, received %s", body)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("invoke(), received error %v", err)
+			}
+
+			var response Response
+			json.Unmarshal(body, &response)
+			expected, _ := json.Marshal(test.expected)
+			if received, _ := json.Marshal(response); !bytes.Equal(received, expected) {
+				t.Errorf("invoke() = %s, expected %s", received, expected)
+			}
+		})
+	}
+}
+
+func echoHandlerV2(ctx context.Context, request events.APIGatewayV2HTTPRequest, executionContext events.ExecutionContext) (Response, error) {
+	return Response{
+		Headers: map[string]string{"Content-Type": request.Headers["content-type"]},
+		Body:    request.RequestContext.HTTP.Method + " " + request.RawPath + " " + request.Body,
+		Cookies: request.Cookies,
+	}, nil
+}
+
+func TestInvokeV2(t *testing.T) {
+	v2Event := `{"version":"2.0","routeKey":"$default","rawPath":"/orders","headers":{"content-type":"text/plain"},` +
+		`"cookies":["session=abc","theme=dark"],"requestContext":{"http":{"method":"POST","path":"/orders"}},"body":"hello"}`
+	tests := []struct {
+		name          string
+		handler       EventHandler
+		request       string
+		expected      Response
+		expectedError error
+	}{
+		{
+			name:    "HTTP trigger",
+			handler: HandlerV2(echoHandlerV2).handleEvent,
+			request: `{"event":` + v2Event + `}`,
+			expected: Response{
+				StatusCode: http.StatusOK,
+				Headers:    map[string]string{"Content-Type": "text/plain"},
+				Body:       "POST /orders hello",
+				Cookies:    []string{"session=abc", "theme=dark"},
+			},
+		},
+		{
+			name:     "other trigger",
+			handler:  HandlerV2(echoHandlerV2).handleEvent,
+			request:  `{"event":"hello"}`,
+			expected: Response{StatusCode: http.StatusOK, Headers: map[string]string{"Content-Type": ""}, Body: "  hello"},
+		},
+		{
+			name:          "payload format 1.0 event",
+			handler:       HandlerV2(echoHandlerV2).handleEvent,
+			request:       `{"event":{"httpMethod":"POST","path":"/orders","body":"hello"}}`,
+			expectedError: ErrorEventFormat,
+		},
+		{
+			name:          "payload format 2.0 event to a payload format 1.0 handler",
+			handler:       Handler(echoHandler).handleEvent,
+			request:       `{"event":` + v2Event + `}`,
+			expectedError: ErrorEventFormat,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := invoke(context.Background(), test.handler, []byte(test.request))
+			if err != test.expectedError {
+				t.Fatalf("invoke(), received error %v, expected %v", err, test.expectedError)
+			}
+			if test.expectedError != nil {
+				return
+			}
+
+			expected, _ := json.Marshal(test.expected)
+			if !bytes.Equal(body, expected) {
+				t.Errorf("invoke() = %s, expected %s", body, expected)
+			}
+			// Core runtime sends the cookies of the response as Set-Cookie headers
+			if response, err := handler.GetResponseFormat(bytes.NewReader(body), events.EventFormatV2); err != nil || len(response.Cookies) != len(test.expected.Cookies) {
+				t.Errorf("GetResponseFormat() = %+v, %v, expected cookies %v", response, err, test.expected.Cookies)
+			}
+		})
+	}
+
+	t.Run("streamed body", func(t *testing.T) {
+		event := `{"version":"2.0","headers":{"content-type":"application/octet-stream"},"requestContext":{"http":{"method":"PUT"}}}`
+		body, err := invokeWithBody(context.Background(), HandlerV2(func(ctx context.Context, request events.APIGatewayV2HTTPRequest, executionContext events.ExecutionContext) (Response, error) {
+			return Response{Body: request.Body, IsBase64Encoded: request.IsBase64Encoded}, nil
+		}).handleEvent, []byte(`{"event":`+event+`}`), []byte("hello"), nil)
+		if err != nil {
+			t.Fatalf("invokeWithBody(), received error %v", err)
+		}
+		var response Response
+		json.Unmarshal(body, &response)
+		if !response.IsBase64Encoded || response.Body != base64.StdEncoding.EncodeToString([]byte("hello")) {
+			t.Errorf("invokeWithBody() = %s, expected the binary body to be base64-encoded", body)
+		}
+	})
+}
+
+func TestInvokeEvent(t *testing.T) {
+	// Cron events are not HTTP requests, event handlers receive them as they are
+	cronHandler := func(ctx context.Context, event json.RawMessage, executionContext events.ExecutionContext) (Response, error) {
+		var cron events.CronEvent
+		if err := json.Unmarshal(event, &cron); err != nil {
+			return Response{}, err
+		}
+		return Response{Body: cron.Schedule + " " + string(cron.Args)}, nil
+	}
+
+	body, err := invoke(context.Background(), cronHandler, []byte(`{"event":{"schedule":"*/5 * * * *","args":{"key":"value"}}}`))
+	if err != nil {
+		t.Fatalf("invoke(), received error %v", err)
+	}
+	var response Response
+	json.Unmarshal(body, &response)
+	if expected := `*/5 * * * * {"key":"value"}`; response.Body != expected {
+		t.Errorf("invoke() = %s, expected body %s", body, expected)
+	}
+
+	rawHandler := func(ctx context.Context, event json.RawMessage, executionContext events.ExecutionContext) (Response, error) {
+		return Response{Body: string(event)}, nil
+	}
+	cloudEvent := `{"specversion":"1.0","id":"1","source":"/orders","type":"order.created","datacontenttype":"text/plain"`
+	tests := []struct {
+		name        string
+		event       string
+		requestBody []byte
+		expected    string
+	}{
+		{"CloudEvent", cloudEvent + `,"data":"hello"}`, nil, cloudEvent + `,"data":"hello"}`},
+		{"batch of CloudEvents", `[` + cloudEvent + `}]`, nil, `[` + cloudEvent + `}]`},
+		{"streamed CloudEvent data", cloudEvent + `}`, []byte("hello"), cloudEvent + `,"data":"hello"}`},
+		// Streamed request bodies of other triggers are the event itself
+		{"streamed payload", `""`, []byte("hello"), `"hello"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := invokeWithBody(context.Background(), rawHandler, []byte(`{"event":`+test.event+`}`), test.requestBody, nil)
+			if err != nil {
+				t.Fatalf("invokeWithBody(), received error %v", err)
+			}
+			var response Response
+			json.Unmarshal(body, &response)
+			if response.Body != test.expected {
+				t.Errorf("invokeWithBody() = %s, expected body %s", body, test.expected)
+			}
+		})
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	server := httptest.NewServer(httpHandler(Handler(echoHandler).handleEvent))
+	defer server.Close()
+
+	res, err := http.Post(server.URL, "application/json", strings.NewReader(`{"event":{"body":"fail"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Errorf("handler error answered with status %d, expected %d", res.StatusCode, http.StatusInternalServerError)
+	}
+
+	// Streamed request bodies follow the invocation, on its next line
+	res, err = http.Post(server.URL, streamContentType, strings.NewReader("{\"event\":{\"httpMethod\":\"POST\"},\"context\":{\"invocationId\":\"id\"}}\nline 1\nline 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if expected := `"body":"line 1\nline 2 id"`; !strings.Contains(string(body), expected) {
+		t.Errorf("streamed invocation answered with %s, expected it to contain %s", body, expected)
+	}
+
+	res, err = http.Get(server.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("health check answered with status %d, expected %d", res.StatusCode, http.StatusOK)
+	}
+}
+
+func TestStreamedBinaryBody(t *testing.T) {
+	bodyHandler := func(ctx context.Context, request events.APIGatewayProxyRequest, executionContext events.ExecutionContext) (Response, error) {
+		return Response{Body: request.Body, IsBase64Encoded: request.IsBase64Encoded}, nil
+	}
+	server := httptest.NewServer(httpHandler(Handler(bodyHandler).handleEvent))
+	defer server.Close()
+
+	tests := []struct {
+		name            string
+		contentType     string
+		body            []byte
+		expectedEncoded bool
+	}{
+		{"invalid UTF-8", "text/plain", []byte{'a', 0xff, 0xfe, 0x00}, true},
+		{"binary content type", "application/octet-stream", []byte("hello"), true},
+		{"text", "text/plain", []byte("hello"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			invocation := `{"event":{"httpMethod":"POST","headers":{"content-type":"` + test.contentType + `"}}}` + "\n"
+			res, err := http.Post(server.URL, streamContentType, io.MultiReader(strings.NewReader(invocation), bytes.NewReader(test.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var response Response
+			json.NewDecoder(res.Body).Decode(&response)
+			res.Body.Close()
+
+			received := []byte(response.Body)
+			if response.IsBase64Encoded {
+				received, _ = base64.StdEncoding.DecodeString(response.Body)
+			}
+			if response.IsBase64Encoded != test.expectedEncoded || !bytes.Equal(received, test.body) {
+				t.Errorf("handler received %q (base64-encoded: %v), expected %q (base64-encoded: %v)",
+					received, response.IsBase64Encoded, test.body, test.expectedEncoded)
+			}
+		})
+	}
+}
+
+func TestServeStdio(t *testing.T) {
+	var input, output bytes.Buffer
+	framing.Write(&input, framing.TypeInvocation, []byte(`{"event":{"body":"hello"}}`))
+	framing.Write(&input, framing.TypeInvocation, []byte(`{"event":{"body":"fail"}}`))
+
+	if err := serveStdio(Handler(echoHandler).handleEvent, &input, &output); err != nil {
+		t.Fatalf("serveStdio(), received error %v", err)
+	}
+
+	expectedTypes := []framing.Type{framing.TypeResult, framing.TypeError}
+	for _, expectedType := range expectedTypes {
+		frameType, payload, err := framing.Read(&output)
+		if err != nil || frameType != expectedType {
+			t.Errorf("response %q %s, %v, expected type %q", frameType, payload, err, expectedType)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package scwfunc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/scaleway/functions-runtime/framing"
+)
+
+// serveStdio - serve invocations read on the given input, one at a time, and write responses on the given output,
+// until the input is closed
+func serveStdio(handler EventHandler, input io.Reader, output io.Writer) error {
+	reader := bufio.NewReader(input)
+	for {
+		frameType, payload, err := framing.Read(reader)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if frameType != framing.TypeInvocation {
+			return fmt.Errorf("unexpected frame type %q", frameType)
+		}
+
+		response, err := invoke(context.Background(), handler, payload)
+		if err != nil {
+			err = framing.Write(output, framing.TypeError, []byte(err.Error()))
+		} else {
+			err = framing.Write(output, framing.TypeResult, response)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
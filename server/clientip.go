@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/scaleway/functions-runtime/logging"
+)
+
+// trustedProxies - networks of the proxies in front of the runtime, whose X-Forwarded-For headers can be trusted
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies - parse a list of CIDRs (e.g. 10.0.0.0/8) and IP addresses, invalid elements are ignored
+func parseTrustedProxies(list []string) trustedProxies {
+	proxies := trustedProxies{}
+	for _, element := range list {
+		if !strings.Contains(element, "/") {
+			if ip := net.ParseIP(element); ip != nil {
+				bits := 8 * len(ip.To4())
+				if bits == 0 {
+					bits = 8 * net.IPv6len
+				}
+				proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+		_, network, err := net.ParseCIDR(element)
+		if err != nil {
+			logging.Warnf("Ignoring invalid trusted proxy %q", element)
+			continue
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies
+}
+
+func (p trustedProxies) trusts(ip net.IP) bool {
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceIP - IP address of the client which sent the request, X-Forwarded-For is only used when the request comes
+// from a trusted proxy, and is read from the right to skip addresses added by trusted proxies, as clients can
+// forge the leftmost ones
+func (p trustedProxies) sourceIP(r *http.Request) string {
+	remoteAddr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+	remoteIP := net.ParseIP(remoteAddr)
+	if remoteIP == nil || !p.trusts(remoteIP) {
+		return remoteAddr
+	}
+
+	forwarded := []string{}
+	for _, header := range r.Header[http.CanonicalHeaderKey("X-Forwarded-For")] {
+		for _, address := range strings.Split(header, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				forwarded = append(forwarded, address)
+			}
+		}
+	}
+
+	sourceIP := remoteAddr
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(forwarded[i])
+		if ip == nil {
+			// Addresses left of an invalid one can not be trusted
+			break
+		}
+		sourceIP = ip.String()
+		if !p.trusts(ip) {
+			break
+		}
+	}
+	return sourceIP
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSourceIP(t *testing.T) {
+	proxies := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "invalid"})
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		expectedIP   string
+	}{
+		{"direct client", "203.0.113.7:4242", nil, "203.0.113.7"},
+		{"untrusted proxy", "203.0.113.7:4242", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:4242", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"trusted proxy without header", "10.1.2.3:4242", nil, "10.1.2.3"},
+		{"forged leftmost address", "10.1.2.3:4242", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.1.2.3:4242", []string{"198.51.100.1, 192.168.1.1", "10.9.9.9"}, "198.51.100.1"},
+		{"only trusted proxies", "10.1.2.3:4242", []string{"10.4.4.4, 192.168.1.1"}, "10.4.4.4"},
+		{"invalid address", "10.1.2.3:4242", []string{"198.51.100.1, garbage"}, "10.1.2.3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.RemoteAddr = test.remoteAddr
+			for _, header := range test.forwardedFor {
+				request.Header.Add("X-Forwarded-For", header)
+			}
+			if ip := proxies.sourceIP(request); ip != test.expectedIP {
+				t.Errorf("sourceIP() = %s, expected %s", ip, test.expectedIP)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/scaleway/functions-runtime/cors"
+)
+
+// setUpCORS - read the CORS policy of the function from the JSON file given in SCW_CORS_CONFIG_FILE, if any,
+// SCW_CORS_* environment variables override the fields of the file, or of the default policy
+func setUpCORS() (cors.Policy, error) {
+	policy := cors.DefaultPolicy
+	if path := os.Getenv("SCW_CORS_CONFIG_FILE"); path != "" {
+		var err error
+		if policy, err = cors.ReadPolicy(path); err != nil {
+			return cors.Policy{}, err
+		}
+	}
+
+	// Lists are comma-separated, an empty list of origins disables CORS
+	if origins, ok := os.LookupEnv("SCW_CORS_ALLOWED_ORIGINS"); ok {
+		policy.AllowedOrigins = cors.SplitList(origins)
+	}
+	if methods, ok := os.LookupEnv("SCW_CORS_ALLOWED_METHODS"); ok {
+		policy.AllowedMethods = cors.SplitList(methods)
+	}
+	if headers, ok := os.LookupEnv("SCW_CORS_ALLOWED_HEADERS"); ok {
+		policy.AllowedHeaders = cors.SplitList(headers)
+	}
+	if headers, ok := os.LookupEnv("SCW_CORS_EXPOSED_HEADERS"); ok {
+		policy.ExposedHeaders = cors.SplitList(headers)
+	}
+	if credentials, err := strconv.ParseBool(os.Getenv("SCW_CORS_ALLOW_CREDENTIALS")); err == nil {
+		policy.AllowCredentials = credentials
+	}
+	policy.MaxAge = intFromEnv("SCW_CORS_MAX_AGE", policy.MaxAge)
+	if err := policy.Validate(); err != nil {
+		return cors.Policy{}, err
+	}
+	return policy, nil
+}
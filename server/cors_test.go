@@ -0,0 +1,35 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/scaleway/functions-runtime/cors"
+)
+
+func TestSetUpCORS(t *testing.T) {
+	tests := []struct {
+		name          string
+		origins       string
+		expectedError error
+	}{
+		{"credentials from any origin", "*", cors.ErrorCredentialsFromAnyOrigin},
+		{"credentials from any https origin", "https://example.com,https://*", cors.ErrorCredentialsFromAnyOrigin},
+		{"credentials from subdomains", "https://*.example.com", nil},
+		{"credentials from listed origins", "https://example.com", nil},
+	}
+
+	defer os.Unsetenv("SCW_CORS_ALLOWED_ORIGINS")
+	defer os.Unsetenv("SCW_CORS_ALLOW_CREDENTIALS")
+	os.Setenv("SCW_CORS_ALLOW_CREDENTIALS", "true")
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Setenv("SCW_CORS_ALLOWED_ORIGINS", test.origins)
+			if _, err := setUpCORS(); !errors.Is(err, test.expectedError) {
+				t.Errorf("setUpCORS(), received error %v, expected %v", err, test.expectedError)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/scaleway/functions-runtime/handler"
+)
+
+// Statuses of cron invocations, in acknowledgements
+const (
+	cronStatusSucceeded = "succeeded"
+	cronStatusFailed    = "failed"
+)
+
+// cronAcknowledgement - answer to the scheduler of cron triggers, holding the result of the handler or its error
+type cronAcknowledgement struct {
+	Status string          `json:"status"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// writeCronResult - acknowledge a cron invocation with the result returned by the handler, passed as-is if it is
+// JSON and as a string otherwise
+func writeCronResult(ctx context.Context, w http.ResponseWriter, handlerResponse io.Reader) {
+	result, err := ioutil.ReadAll(handlerResponse)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = handler.ErrorExecutionTimeout
+		}
+		writeCronError(w, err)
+		return
+	}
+
+	ack := cronAcknowledgement{Status: cronStatusSucceeded}
+	if len(result) > 0 {
+		if json.Valid(result) {
+			ack.Result = result
+		} else {
+			ack.Result, _ = json.Marshal(string(result))
+		}
+	}
+	writeCronAcknowledgement(w, http.StatusOK, ack)
+}
+
+// writeCronError - acknowledge a failed cron invocation, with the status code of the error as for other triggers
+func writeCronError(w http.ResponseWriter, err error) {
+	writeCronAcknowledgement(w, executionErrorStatus(w, err), cronAcknowledgement{Status: cronStatusFailed, Error: err.Error()})
+}
+
+func writeCronAcknowledgement(w http.ResponseWriter, status int, ack cronAcknowledgement) {
+	body, _ := json.Marshal(ack)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/scaleway/functions-runtime/handler"
+)
+
+func TestWriteCronResult(t *testing.T) {
+	tests := []struct {
+		name           string
+		result         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"JSON result", `{"sent": 3}`, 200, `{"status":"succeeded","result":{"sent":3}}`},
+		{"text result", "done", 200, `{"status":"succeeded","result":"done"}`},
+		{"no result", "", 200, `{"status":"succeeded"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			writeCronResult(context.Background(), recorder, strings.NewReader(test.result))
+			if recorder.Code != test.expectedStatus || recorder.Body.String() != test.expectedBody {
+				t.Errorf("response = %d %s, expected %d %s", recorder.Code, recorder.Body, test.expectedStatus, test.expectedBody)
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Content-Type = %q, expected application/json", contentType)
+			}
+		})
+	}
+}
+
+func TestWriteCronError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"handler error", errors.New("division by zero"), 500, `{"status":"failed","error":"division by zero"}`},
+		{"timeout", handler.ErrorExecutionTimeout, 504, `{"status":"failed","error":"` + handler.ErrorExecutionTimeout.Error() + `"}`},
+		{"response too large", ErrorResponseTooLarge, 502, `{"status":"failed","error":"Handler response too large"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			writeCronError(recorder, test.err)
+			if recorder.Code != test.expectedStatus || recorder.Body.String() != test.expectedBody {
+				t.Errorf("response = %d %s, expected %d %s", recorder.Code, recorder.Body, test.expectedStatus, test.expectedBody)
+			}
+		})
+	}
+}
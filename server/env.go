@@ -0,0 +1,48 @@
+package server
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// intFromEnv - read an integer from the given environment variable, or return fallback if unset or invalid
+func intFromEnv(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// durationFromEnv - read a duration from the given environment variable, either as a Go duration (e.g. "1m30s")
+// or as a number of seconds, or return fallback if unset or invalid
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return duration
+	}
+	return fallback
+}
+
+// listFromEnv - read a comma-separated list from the given environment variable, or return fallback if unset
+func listFromEnv(name string, fallback []string) []string {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return fallback
+	}
+	list := []string{}
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			list = append(list, element)
+		}
+	}
+	return list
+}
@@ -1,8 +1,51 @@
 package server
 
 import (
-	"fmt"
+	"errors"
+	"net/http"
+
+	"github.com/scaleway/functions-runtime/handler"
+)
+
+const (
+	// retryAfterNotReady - delay in seconds after which callers may retry an invocation received while the sub-runtime was not ready
+	retryAfterNotReady = "1"
+	// retryAfterSaturated - delay in seconds after which callers may retry an invocation rejected by the concurrency limit
+	retryAfterSaturated = "1"
 )
 
-// ErrorPayloadTooLarge - Error type for payload size is grater that anticipated
-var ErrorPayloadTooLarge = fmt.Errorf("Request payload too large, max payload size = %d bytes", payloadMaxSize)
+var (
+	// ErrorPayloadTooLarge - Error type for request payloads larger than the configured limit
+	ErrorPayloadTooLarge = errors.New("Request payload too large")
+	// ErrorResponseTooLarge - Error type for handler responses larger than the configured limit
+	ErrorResponseTooLarge = errors.New("Handler response too large")
+)
+
+// writeExecutionError - send the HTTP error matching the failed execution of the handler
+func writeExecutionError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), executionErrorStatus(w, err))
+}
+
+// executionErrorStatus - status code matching the failed execution of the handler, sets the Retry-After header
+// when callers may retry
+func executionErrorStatus(w http.ResponseWriter, err error) int {
+	status := http.StatusInternalServerError
+	switch err {
+	case handler.ErrorExecutionTimeout:
+		status = http.StatusGatewayTimeout
+	case handler.ErrorSubRuntimeCrashed, handler.ErrorSubRuntimeStopped:
+		status = http.StatusBadGateway
+	case handler.ErrorSubRuntimeNotReady:
+		status = http.StatusServiceUnavailable
+		w.Header().Set("Retry-After", retryAfterNotReady)
+	case handler.ErrorTooManyInvocations:
+		status = http.StatusTooManyRequests
+		w.Header().Set("Retry-After", retryAfterSaturated)
+	case handler.ErrorQueueTimeout:
+		status = http.StatusServiceUnavailable
+		w.Header().Set("Retry-After", retryAfterSaturated)
+	case ErrorResponseTooLarge:
+		status = http.StatusBadGateway
+	}
+	return status
+}
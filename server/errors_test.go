@@ -0,0 +1,39 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/scaleway/functions-runtime/handler"
+)
+
+func TestWriteExecutionError(t *testing.T) {
+	tests := []struct {
+		err                error
+		expectedStatus     int
+		expectedRetryAfter string
+	}{
+		{handler.ErrorSubRuntimeNotReady, http.StatusServiceUnavailable, retryAfterNotReady},
+		{handler.ErrorExecutionTimeout, http.StatusGatewayTimeout, ""},
+		{handler.ErrorSubRuntimeCrashed, http.StatusBadGateway, ""},
+		{handler.ErrorTooManyInvocations, http.StatusTooManyRequests, retryAfterSaturated},
+		{handler.ErrorQueueTimeout, http.StatusServiceUnavailable, retryAfterSaturated},
+		{errors.New("handler failed"), http.StatusInternalServerError, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.err.Error(), func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			writeExecutionError(recorder, test.err)
+
+			if recorder.Code != test.expectedStatus {
+				t.Errorf("status = %d, expected %d", recorder.Code, test.expectedStatus)
+			}
+			if retryAfter := recorder.Header().Get("Retry-After"); retryAfter != test.expectedRetryAfter {
+				t.Errorf("Retry-After = %q, expected %q", retryAfter, test.expectedRetryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHealthPathPrefix = "/_scw"
+	healthCheckTimeout      = time.Second
+)
+
+// subRuntimeStatus - state of the sub-runtime reported by health endpoints
+type subRuntimeStatus interface {
+	HasStarted() bool
+	Ping(ctx context.Context) error
+}
+
+// healthChecks - reserved endpoints answering orchestrator probes, they are served before authentication
+// and never forwarded to the function handler:
+// - {prefix}/live: core runtime is up and serving requests
+// - {prefix}/ready: sub-runtime is up and answering, so invocations can be handled
+// - {prefix}/startup: sub-runtime has completed its first startup
+type healthChecks struct {
+	prefix     string
+	subRuntime subRuntimeStatus
+}
+
+// serveHTTP - answer the request if it targets a reserved endpoint, returns false if the request must be
+// handled as a function invocation
+func (h *healthChecks) serveHTTP(w http.ResponseWriter, r *http.Request) bool {
+	if !strings.HasPrefix(r.URL.Path, h.prefix+"/") {
+		return false
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return true
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, h.prefix) {
+	case "/live":
+		writeHealthStatus(w, nil)
+	case "/ready":
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+		writeHealthStatus(w, h.subRuntime.Ping(ctx))
+	case "/startup":
+		if h.subRuntime.HasStarted() {
+			writeHealthStatus(w, nil)
+		} else {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+	return true
+}
+
+func writeHealthStatus(w http.ResponseWriter, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, "ok")
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeSubRuntime struct {
+	started bool
+	pingErr error
+}
+
+func (f *fakeSubRuntime) HasStarted() bool {
+	return f.started
+}
+
+func (f *fakeSubRuntime) Ping(ctx context.Context) error {
+	return f.pingErr
+}
+
+func testHealthCheck(subRuntime *fakeSubRuntime, method, path string) (bool, int) {
+	health := &healthChecks{prefix: defaultHealthPathPrefix, subRuntime: subRuntime}
+	recorder := httptest.NewRecorder()
+	handled := health.serveHTTP(recorder, httptest.NewRequest(method, path, nil))
+	return handled, recorder.Code
+}
+
+func TestHealthChecks(t *testing.T) {
+	starting := &fakeSubRuntime{pingErr: errors.New("not ready")}
+	running := &fakeSubRuntime{started: true}
+	crashed := &fakeSubRuntime{started: true, pingErr: errors.New("not ready")}
+
+	tests := []struct {
+		name       string
+		subRuntime *fakeSubRuntime
+		method     string
+		path       string
+		handled    bool
+		status     int
+	}{
+		{"invocation is not handled", running, http.MethodGet, "/", false, http.StatusOK},
+		{"prefix only is not handled", running, http.MethodGet, "/_scw", false, http.StatusOK},
+		{"live while starting", starting, http.MethodGet, "/_scw/live", true, http.StatusOK},
+		{"ready while starting", starting, http.MethodGet, "/_scw/ready", true, http.StatusServiceUnavailable},
+		{"startup while starting", starting, http.MethodGet, "/_scw/startup", true, http.StatusServiceUnavailable},
+		{"ready while running", running, http.MethodGet, "/_scw/ready", true, http.StatusOK},
+		{"startup while running", running, http.MethodHead, "/_scw/startup", true, http.StatusOK},
+		{"ready after a crash", crashed, http.MethodGet, "/_scw/ready", true, http.StatusServiceUnavailable},
+		{"startup after a crash", crashed, http.MethodGet, "/_scw/startup", true, http.StatusOK},
+		{"unknown reserved endpoint", running, http.MethodGet, "/_scw/unknown", true, http.StatusNotFound},
+		{"invalid method", running, http.MethodPost, "/_scw/live", true, http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handled, status := testHealthCheck(test.subRuntime, test.method, test.path)
+			if handled != test.handled {
+				t.Errorf("serveHTTP() = %v, expected %v", handled, test.handled)
+			}
+			if handled && status != test.status {
+				t.Errorf("status = %d, expected %d", status, test.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// headerRequestID - header holding the unique identifier of an invocation, read from requests and set on responses
+	headerRequestID    = "X-Request-Id"
+	maxRequestIDLength = 128
+)
+
+// invocationID - identifier of the invocation, provided by the caller in the X-Request-Id header or generated
+func invocationID(r *http.Request) string {
+	if id := r.Header.Get(headerRequestID); isValidRequestID(id) {
+		return id
+	}
+	return newUUID()
+}
+
+// isValidRequestID - only accept identifiers which are safe to write in logs and headers
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newUUID - generate a random (version 4) UUID
+func newUUID() string {
+	var uuid [16]byte
+	rand.Read(uuid[:])
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestInvocationID(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		generated bool
+	}{
+		{"generated when missing", "", true},
+		{"accepted from header", "my-request-id", false},
+		{"generated when header contains spaces", "my request", true},
+		{"generated when header is too long", strings.Repeat("a", maxRequestIDLength+1), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/", nil)
+			if test.header != "" {
+				request.Header.Set(headerRequestID, test.header)
+			}
+
+			id := invocationID(request)
+			if test.generated && !uuidPattern.MatchString(id) {
+				t.Errorf("invocationID() = %s, expected a generated UUID", id)
+			} else if !test.generated && id != test.header {
+				t.Errorf("invocationID() = %s, expected %s", id, test.header)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"os"
+
+	"github.com/scaleway/functions-runtime/events"
+	"github.com/scaleway/functions-runtime/logging"
+)
+
+// setUpLogging - configure the default logger from environment variables, every entry identifies the function
+func setUpLogging() {
+	format, validFormat := logging.ParseFormat(os.Getenv("SCW_LOG_FORMAT"))
+	level, validLevel := logging.ParseLevel(os.Getenv("SCW_LOG_LEVEL"))
+
+	executionContext := events.GetExecutionContext()
+	logging.SetDefault(logging.New(os.Stderr, format, level).WithFields(logging.Fields{
+		logging.KeyFunctionName:    executionContext.FunctionName,
+		logging.KeyFunctionVersion: executionContext.FunctionVersion,
+	}))
+
+	if !validFormat && os.Getenv("SCW_LOG_FORMAT") != "" {
+		logging.Warnf("Unknown log format %q, using %s", os.Getenv("SCW_LOG_FORMAT"), format)
+	}
+	if !validLevel && os.Getenv("SCW_LOG_LEVEL") != "" {
+		logging.Warnf("Unknown log level %q, using %s", os.Getenv("SCW_LOG_LEVEL"), level)
+	}
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/scaleway/functions-runtime/events"
+	"github.com/scaleway/functions-runtime/handler"
+	"github.com/scaleway/functions-runtime/metrics"
+)
+
+var payloadSizeBuckets = metrics.ExponentialBuckets(256, 4, 9)
+
+// runtimeMetrics - metrics collected by the core runtime about function invocations
+type runtimeMetrics struct {
+	registry         *metrics.Registry
+	invocations      *metrics.Counter
+	handlerDuration  *metrics.Histogram
+	queueDuration    *metrics.Histogram
+	overheadDuration *metrics.Histogram
+	requestSize      *metrics.Histogram
+	responseSize     *metrics.Histogram
+	authFailures     *metrics.Counter
+}
+
+func newRuntimeMetrics(fnInvoker *handler.FunctionInvoker) *runtimeMetrics {
+	registry := metrics.NewRegistry()
+
+	m := &runtimeMetrics{
+		registry: registry,
+		invocations: registry.NewCounter("scw_function_invocations_total",
+			"Number of function invocations, by trigger type and response status code", "trigger", "status"),
+		handlerDuration: registry.NewHistogram("scw_function_handler_duration_seconds",
+			"Time spent executing the function handler in the sub-runtime", metrics.DurationBuckets, "trigger"),
+		queueDuration: registry.NewHistogram("scw_function_queue_duration_seconds",
+			"Time invocations waited for a concurrency slot and a worker, including rejected ones", metrics.DurationBuckets, "trigger"),
+		overheadDuration: registry.NewHistogram("scw_function_core_overhead_duration_seconds",
+			"Time spent by the core runtime handling an invocation, excluding the function handler and the queue", metrics.DurationBuckets, "trigger"),
+		requestSize: registry.NewHistogram("scw_function_request_size_bytes",
+			"Size of invocation request payloads", payloadSizeBuckets, "trigger"),
+		responseSize: registry.NewHistogram("scw_function_response_size_bytes",
+			"Size of invocation response payloads", payloadSizeBuckets, "trigger"),
+		authFailures: registry.NewCounter("scw_function_authentication_failures_total",
+			"Number of invocations rejected by authentication, by reason", "reason"),
+	}
+
+	// Metrics of the sub-runtime are only collected with an invoker
+	if fnInvoker == nil {
+		return m
+	}
+	registry.NewGaugeFunc("scw_function_cold_start_duration_seconds",
+		"Time it took for the sub-runtime to become ready the first time", func() float64 {
+			return fnInvoker.ColdStartDuration().Seconds()
+		})
+	registry.NewGaugeFunc("scw_function_inflight_invocations",
+		"Number of invocations being executed by the sub-runtime", func() float64 {
+			return float64(fnInvoker.InFlightCount())
+		})
+	registry.NewGaugeFunc("scw_function_queued_invocations",
+		"Number of invocations waiting for the concurrency limit to allow their execution", func() float64 {
+			return float64(fnInvoker.QueueLength())
+		})
+	registry.NewGaugeFunc("scw_function_workers",
+		"Number of sub-runtime worker processes", func() float64 {
+			return float64(fnInvoker.WorkerCount())
+		})
+	registry.NewCounterFunc("scw_function_worker_recycles_total",
+		"Number of times a worker was replaced after too many invocations or too much memory growth", func() float64 {
+			return float64(fnInvoker.RecycleCount())
+		})
+	registry.NewCounterFunc("scw_function_subruntime_restarts_total",
+		"Number of times the sub-runtime terminated unexpectedly and was restarted", func() float64 {
+			return float64(fnInvoker.CrashCount())
+		})
+
+	return m
+}
+
+// invocationMetrics - measurements of a single invocation, reported once it is done
+type invocationMetrics struct {
+	metrics         *runtimeMetrics
+	trigger         string
+	start           time.Time
+	queueStart      time.Time
+	queueDuration   time.Duration
+	handlerStart    time.Time
+	handlerDuration time.Duration
+	request         *countingReader
+	response        *responseRecorder
+}
+
+// startInvocation - start measuring an invocation, the returned measurements wrap the request body
+// and the response writer to record payload sizes and response status
+func (m *runtimeMetrics) startInvocation(w http.ResponseWriter, r *http.Request) *invocationMetrics {
+	invocation := &invocationMetrics{
+		metrics:  m,
+		trigger:  triggerLabel(r),
+		start:    time.Now(),
+		response: &responseRecorder{ResponseWriter: w, status: http.StatusOK},
+	}
+	if r.Body != nil {
+		invocation.request = &countingReader{ReadCloser: r.Body}
+		r.Body = invocation.request
+	}
+	return invocation
+}
+
+// startQueue - the invocation is being executed, it waits for a concurrency slot and a worker first
+func (i *invocationMetrics) startQueue() {
+	i.queueStart = time.Now()
+}
+
+// startHandler - the invocation left the queue and is sent to the sub-runtime
+func (i *invocationMetrics) startHandler() {
+	i.handlerStart = time.Now()
+	i.queueDuration = i.handlerStart.Sub(i.queueStart)
+}
+
+// endHandler - the execution of the invocation completed, or it was rejected while in queue
+func (i *invocationMetrics) endHandler() {
+	if i.handlerStart.IsZero() {
+		i.queueDuration = time.Since(i.queueStart)
+		return
+	}
+	i.handlerDuration = time.Since(i.handlerStart)
+}
+
+// done - report measurements of the invocation
+func (i *invocationMetrics) done() {
+	total := time.Since(i.start)
+
+	i.metrics.invocations.Inc(i.trigger, strconv.Itoa(i.response.status))
+	if !i.queueStart.IsZero() {
+		i.metrics.queueDuration.Observe(i.queueDuration.Seconds(), i.trigger)
+	}
+	if !i.handlerStart.IsZero() {
+		i.metrics.handlerDuration.Observe(i.handlerDuration.Seconds(), i.trigger)
+	}
+	i.metrics.overheadDuration.Observe((total - i.queueDuration - i.handlerDuration).Seconds(), i.trigger)
+	if i.request != nil {
+		i.metrics.requestSize.Observe(float64(atomic.LoadInt64(&i.request.count)), i.trigger)
+	}
+	i.metrics.responseSize.Observe(float64(i.response.count), i.trigger)
+}
+
+// triggerLabel - trigger type of the request, even if the request is rejected before its trigger type is checked
+func triggerLabel(r *http.Request) string {
+	triggerType, err := events.GetTriggerType(r.Header.Get(headerTriggerType))
+	if err != nil {
+		return "invalid"
+	}
+	return string(triggerType)
+}
+
+// countingReader - request body counting bytes read from it
+type countingReader struct {
+	// count is accessed atomically, streamed bodies are read by the transport sending them to the sub-runtime,
+	// which may still be reading once the invocation is done, keep it first for 64-bit alignment on 32-bit platforms
+	count int64
+	io.ReadCloser
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(&r.count, int64(n))
+	return n, err
+}
+
+// responseRecorder - response writer recording the status code and the number of bytes written
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	count       int64
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	w.count += int64(n)
+	return n, err
+}
+
+// Flush - send buffered data to the client, so that streamed responses go through the recorder
+func (w *responseRecorder) Flush() {
+	w.wroteHeader = true
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// metricsHandler - serve collected metrics in Prometheus text format on /metrics
+func metricsHandler(runtimeMetrics *runtimeMetrics) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", runtimeMetrics.registry.Handler())
+	return mux
+}
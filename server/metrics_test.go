@@ -0,0 +1,51 @@
+package server
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInvocationMetrics(t *testing.T) {
+	tests := []struct {
+		name            string
+		dispatched      bool
+		expectedHandler bool
+	}{
+		{"dispatched invocation", true, true},
+		{"invocation rejected in queue", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newRuntimeMetrics(nil)
+			invocation := m.startInvocation(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+
+			invocation.startQueue()
+			time.Sleep(50 * time.Millisecond)
+			if test.dispatched {
+				invocation.startHandler()
+			}
+			invocation.endHandler()
+			invocation.done()
+
+			if invocation.queueDuration < 50*time.Millisecond {
+				t.Errorf("queueDuration = %v, expected the time spent in queue", invocation.queueDuration)
+			}
+			if test.dispatched && invocation.handlerDuration >= 50*time.Millisecond {
+				t.Errorf("handlerDuration = %v, expected it to exclude the time spent in queue", invocation.handlerDuration)
+			}
+
+			var output bytes.Buffer
+			m.registry.Write(&output)
+			if observed := strings.Contains(output.String(), "scw_function_handler_duration_seconds_count"); observed != test.expectedHandler {
+				t.Errorf("handler duration observed: %v, expected %v", observed, test.expectedHandler)
+			}
+			if !strings.Contains(output.String(), "scw_function_queue_duration_seconds_count") {
+				t.Error("queue duration was not observed")
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// limitedBody - body failing with the given error once more than limit bytes have been read, so that payload
+// limits are enforced on the bytes actually read, whatever the announced Content-Length
+type limitedBody struct {
+	// exceeded is accessed atomically, request bodies may be read by the transport streaming them to the sub-runtime
+	exceeded  int32
+	body      io.ReadCloser
+	remaining int64
+	err       error
+}
+
+func newLimitedBody(body io.ReadCloser, limit int64, err error) *limitedBody {
+	return &limitedBody{body: body, remaining: limit, err: err}
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if atomic.LoadInt32(&b.exceeded) == 1 {
+		return 0, b.err
+	}
+	// Read one byte more than allowed to detect bodies exceeding the limit
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.body.Read(p)
+	if int64(n) > b.remaining {
+		atomic.StoreInt32(&b.exceeded, 1)
+		n = int(b.remaining)
+		b.remaining = 0
+		return n, b.err
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
+
+// limitExceeded - whether more than limit bytes have been sent
+func (b *limitedBody) limitExceeded() bool {
+	return atomic.LoadInt32(&b.exceeded) == 1
+}
+
+// writePayloadTooLarge - send the error of a request whose payload exceeds the given limit
+func writePayloadTooLarge(w http.ResponseWriter, limit int64) {
+	http.Error(w, fmt.Sprintf("%s, max payload size = %d bytes", ErrorPayloadTooLarge, limit), http.StatusRequestEntityTooLarge)
+}
+
+// writeResponseTooLarge - send the error of an invocation whose handler responded with more than the given limit,
+// the handler is at fault rather than the caller
+func writeResponseTooLarge(w http.ResponseWriter, limit int64) {
+	http.Error(w, fmt.Sprintf("%s, max response size = %d bytes", ErrorResponseTooLarge, limit), http.StatusBadGateway)
+}
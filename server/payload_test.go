@@ -0,0 +1,40 @@
+package server
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestLimitedBody(t *testing.T) {
+	tests := []struct {
+		name             string
+		body             string
+		limit            int64
+		expectedBody     string
+		expectedExceeded bool
+	}{
+		{"under limit", "hello", 10, "hello", false},
+		{"at limit", "hello", 5, "hello", false},
+		{"over limit", "hello world", 5, "hello", true},
+		{"empty", "", 0, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := newLimitedBody(ioutil.NopCloser(strings.NewReader(test.body)), test.limit, ErrorPayloadTooLarge)
+			read, err := ioutil.ReadAll(body)
+			if string(read) != test.expectedBody {
+				t.Errorf("read %q, expected %q", read, test.expectedBody)
+			}
+			if body.limitExceeded() != test.expectedExceeded {
+				t.Errorf("limitExceeded() = %v, expected %v", body.limitExceeded(), test.expectedExceeded)
+			}
+			if test.expectedExceeded && err != ErrorPayloadTooLarge {
+				t.Errorf("read error %v, expected %v", err, ErrorPayloadTooLarge)
+			} else if !test.expectedExceeded && err != nil {
+				t.Errorf("read error %v, expected none", err)
+			}
+		})
+	}
+}
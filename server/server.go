@@ -1,18 +1,26 @@
 package server
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/scaleway/functions-runtime/authentication"
+	"github.com/scaleway/functions-runtime/cors"
 	"github.com/scaleway/functions-runtime/events"
 	"github.com/scaleway/functions-runtime/handler"
+	"github.com/scaleway/functions-runtime/logging"
+	"github.com/scaleway/functions-runtime/tracing"
 )
 
 const (
@@ -21,6 +29,18 @@ const (
 	defaultUpstreamPort = 8081
 	headerTriggerType   = "SCW_TRIGGER_TYPE"
 	payloadMaxSize      = 6291456
+	responseMaxSize     = 6291456
+
+	defaultShutdownGracePeriod = 10 * time.Second
+	defaultStopTimeout         = 5 * time.Second
+	defaultFunctionTimeout     = 5 * time.Minute
+	readHeaderTimeout          = 10 * time.Second
+	idleTimeout                = 2 * time.Minute
+	tracingShutdownTimeout     = 5 * time.Second
+	defaultMaxQueueSize        = 100
+	defaultQueueTimeout        = 10 * time.Second
+	// streamBufferSize - Maximum size of the chunks of streamed responses flushed to the client
+	streamBufferSize = 32 << 10
 )
 
 // Configure function Invoker from environment variables
@@ -47,79 +67,283 @@ func setUpFunctionInvoker() (*handler.FunctionInvoker, error) {
 		upstreamPort = strconv.Itoa(defaultUpstreamPort)
 	}
 	upstreamURL := fmt.Sprintf("%s:%s", upstreamHost, upstreamPort)
+	// Sub-runtime may listen on a Unix socket (e.g. unix:///run/scw/upstream.sock), upstream port is then only used
+	// by sub-runtimes which do not support it
+	fallbackUpstreamURL := fmt.Sprintf("%s:%s", defaultUpstreamHost, upstreamPort)
+	if strings.HasPrefix(upstreamHost, "unix://") {
+		upstreamURL = upstreamHost
+	}
 
 	fnInvoker, err := handler.NewInvoker(runtimeBinary, runtimeBridgeFile, handlerPath, handlerName, upstreamURL, isBinaryHandler == "true")
 	if err != nil {
 		return nil, err
 	}
 
+	fnInvoker.FallbackUpstreamURL = fallbackUpstreamURL
+	if protocol := os.Getenv("SCW_RUNTIME_PROTOCOL"); protocol != "" {
+		fnInvoker.Protocol = protocol
+	}
+
+	// Configure how sub-runtime is restarted when it crashes
+	fnInvoker.RestartPolicy = handler.RestartPolicy{
+		InitialBackoff: durationFromEnv("SCW_RUNTIME_RESTART_BACKOFF", handler.DefaultRestartPolicy.InitialBackoff),
+		MaxBackoff:     durationFromEnv("SCW_RUNTIME_RESTART_MAX_BACKOFF", handler.DefaultRestartPolicy.MaxBackoff),
+		MaxCrashes:     intFromEnv("SCW_RUNTIME_MAX_CRASHES", handler.DefaultRestartPolicy.MaxCrashes),
+		CrashWindow:    durationFromEnv("SCW_RUNTIME_CRASH_WINDOW", handler.DefaultRestartPolicy.CrashWindow),
+	}
+	// Configure how sub-runtime readiness is checked when it starts
+	fnInvoker.StartupTimeout = durationFromEnv("SCW_RUNTIME_STARTUP_TIMEOUT", handler.DefaultStartupTimeout)
+	fnInvoker.HealthPath = os.Getenv("SCW_UPSTREAM_HEALTH_PATH")
+	fnInvoker.MaxConcurrency = intFromEnv("SCW_MAX_CONCURRENCY", 0)
+	fnInvoker.MaxQueueSize = intFromEnv("SCW_QUEUE_MAX_SIZE", defaultMaxQueueSize)
+	fnInvoker.QueueTimeout = durationFromEnv("SCW_QUEUE_TIMEOUT", defaultQueueTimeout)
+	// Lines the sub-runtime writes on stderr without a level are info entries, unless configured otherwise
+	if level, ok := logging.ParseLevel(os.Getenv("SCW_STDERR_LOG_LEVEL")); ok {
+		fnInvoker.StderrLevel = level
+	}
+	// Request bodies are part of events by default, sub-runtimes must support streamed bodies to enable it
+	fnInvoker.StreamRequestBody = os.Getenv("SCW_STREAM_REQUEST_BODY") == "true"
+
+	// Configure the pool of sub-runtime processes, by default a single process handles all invocations
+	fnInvoker.MinWorkers = intFromEnv("SCW_MIN_WORKERS", fnInvoker.MinWorkers)
+	fnInvoker.MaxWorkers = intFromEnv("SCW_MAX_WORKERS", fnInvoker.MinWorkers)
+	fnInvoker.WorkerIdleTimeout = durationFromEnv("SCW_WORKER_IDLE_TIMEOUT", handler.DefaultWorkerIdleTimeout)
+	fnInvoker.WorkerMaxInvocations = intFromEnv("SCW_WORKER_MAX_INVOCATIONS", 0)
+	if maxMemoryGrowth := intFromEnv("SCW_WORKER_MAX_MEMORY_GROWTH", 0); maxMemoryGrowth > 0 {
+		fnInvoker.WorkerMaxMemoryGrowth = uint64(maxMemoryGrowth)
+	}
+
 	return fnInvoker, nil
 }
 
 // Start takes the function Handler, at the moment only supporting HTTP Triggers (Api Gateway Proxy events)
 // It takes care of wrapping the handler with an HTTP server, which receives requests when functions are triggered
 // And execute the handler after formatting the HTTP CoreRuntimeRequest to an API Gateway Proxy Event
+// On SIGTERM or SIGINT, the server stops accepting connections, waits for in-flight invocations to complete
+// within the configured grace period, and terminates the sub-runtime
 func Start() error {
+	setUpLogging()
+
 	portEnv := os.Getenv("PORT")
 	port, err := strconv.Atoi(portEnv)
 	if err != nil {
 		port = defaultPort
 	}
 
-	requestHandler, err := buildRequestHandler()
+	setUpTracing()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		tracing.Shutdown(ctx)
+	}()
+
+	fnInvoker, err := setUpFunctionInvoker()
 	if err != nil {
-		// TODO: FORMAT ERROR
 		return err
 	}
+	// Workers must not listen on the ports of the core runtime
+	fnInvoker.ReservedPorts = []int{port}
+	metricsPort := os.Getenv("SCW_METRICS_PORT")
+	if port, err := strconv.Atoi(metricsPort); err == nil {
+		fnInvoker.ReservedPorts = append(fnInvoker.ReservedPorts, port)
+	}
+
+	corsPolicy, err := setUpCORS()
+	if err != nil {
+		return fmt.Errorf("unable to read CORS policy: %v", err)
+	}
+
+	// Signals received while the sub-runtime starts are handled once the server runs, so that it is always stopped
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	// Start function server
+	if err := fnInvoker.Start(); err != nil {
+		return err
+	}
+
+	runtimeMetrics := newRuntimeMetrics(fnInvoker)
+	requestHandler := buildRequestHandler(fnInvoker, runtimeMetrics, corsPolicy)
+
+	// Metrics are served on a dedicated port, so that they are never exposed with the function itself
+	if metricsPort != "" {
+		metricsServer := &http.Server{
+			Addr:              ":" + metricsPort,
+			Handler:           metricsHandler(runtimeMetrics),
+			ReadHeaderTimeout: readHeaderTimeout,
+		}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != http.ErrServerClosed {
+				logging.Errorf("Metrics server has terminated: %v", err)
+			}
+		}()
+		defer metricsServer.Close()
+	}
 
 	s := &http.Server{
 		Addr:           fmt.Sprintf(":%d", port),
 		MaxHeaderBytes: 1 << 20, // Max header of 1MB
 		Handler:        http.HandlerFunc(requestHandler),
-		// NOTE: we should either set timeouts or make explicit we don't need them
+		// Handler execution is bounded by the function timeout, only protect the server against slow or idle clients
 		// see https://ieftimov.com/post/make-resilient-golang-net-http-servers-using-timeouts-deadlines-context-cancellation/
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
 	}
-	log.Fatal(s.ListenAndServe())
 
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- s.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		fnInvoker.Stop(durationFromEnv("SCW_RUNTIME_STOP_TIMEOUT", defaultStopTimeout))
+		return err
+	case <-fnInvoker.Done():
+		// Sub-runtime is restarted when it crashes, only stop the core runtime when it gave up
+		s.Close()
+		return fmt.Errorf("forked function has terminated: %s", fnInvoker.Err().Error())
+	case sig := <-signals:
+		logging.Infof("Received %v, shutting down", sig)
+	}
+
+	return shutdown(s, fnInvoker)
+}
+
+// shutdown - stop accepting connections and drain in-flight invocations before terminating the sub-runtime
+func shutdown(s *http.Server, fnInvoker *handler.FunctionInvoker) error {
+	gracePeriod := durationFromEnv("SCW_SHUTDOWN_GRACE_PERIOD", defaultShutdownGracePeriod)
+	stopTimeout := durationFromEnv("SCW_RUNTIME_STOP_TIMEOUT", defaultStopTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	shutdownErr := s.Shutdown(ctx)
+	if shutdownErr != nil {
+		// Grace period is over, abort remaining connections
+		s.Close()
+	}
+
+	if err := fnInvoker.Stop(stopTimeout); err != nil {
+		return err
+	}
+	if shutdownErr != nil {
+		return fmt.Errorf("in-flight invocations did not complete within %v: %s", gracePeriod, shutdownErr.Error())
+	}
+
+	logging.Infof("Shutdown complete")
 	return nil
 }
 
-func buildRequestHandler() (func(http.ResponseWriter, *http.Request), error) {
-	fnInvoker, err := setUpFunctionInvoker()
-	if err != nil {
-		return nil, err
+func buildRequestHandler(fnInvoker *handler.FunctionInvoker, runtimeMetrics *runtimeMetrics, corsPolicy cors.Policy) func(http.ResponseWriter, *http.Request) {
+	// Maximum duration of a single invocation, including the handler's response
+	functionTimeout := durationFromEnv("SCW_FUNCTION_TIMEOUT", defaultFunctionTimeout)
+
+	healthPathPrefix := os.Getenv("SCW_HEALTH_PATH_PREFIX")
+	if healthPathPrefix == "" {
+		healthPathPrefix = defaultHealthPathPrefix
 	}
+	health := &healthChecks{prefix: strings.TrimSuffix(healthPathPrefix, "/"), subRuntime: fnInvoker}
 
-	// Start function server
-	if err := fnInvoker.Start(); err != nil {
-		return nil, err
+	// Header names of HTTP events are canonicalized by default
+	headerCase, ok := events.ParseHeaderCase(os.Getenv("SCW_HEADER_CASE"))
+	if !ok && os.Getenv("SCW_HEADER_CASE") != "" {
+		logging.Warnf("Unknown header case %q, using %s", os.Getenv("SCW_HEADER_CASE"), headerCase)
+	}
+
+	// HTTP events are in payload format 1.0 by default
+	eventFormat, ok := events.ParseEventFormat(os.Getenv("SCW_EVENT_FORMAT"))
+	if !ok && os.Getenv("SCW_EVENT_FORMAT") != "" {
+		logging.Warnf("Unknown event format %q, using %s", os.Getenv("SCW_EVENT_FORMAT"), eventFormat)
+	}
+
+	// Requests of non-HTTP triggers hold CloudEvents
+	cloudEvents := os.Getenv("SCW_CLOUDEVENTS") == "true"
+
+	// Request bodies of other media types, or which are not valid UTF-8, are base64-encoded in HTTP events
+	textContentTypes := listFromEnv("SCW_TEXT_CONTENT_TYPES", events.DefaultTextContentTypes)
+
+	// Source IPs of requests are read from X-Forwarded-For only when they come from these proxies
+	proxies := parseTrustedProxies(listFromEnv("SCW_TRUSTED_PROXIES", nil))
+
+	// Deployment of the function, in the request context of HTTP events
+	stage := os.Getenv("SCW_STAGE")
+	applicationID := os.Getenv("SCW_APPLICATION_ID")
+	namespaceID := os.Getenv("SCW_NAMESPACE_ID")
+
+	// Maximum size of request bodies, and of responses of handlers, in bytes
+	payloadLimit := int64(intFromEnv("SCW_PAYLOAD_MAX_SIZE", payloadMaxSize))
+	if payloadLimit <= 0 {
+		payloadLimit = payloadMaxSize
+	}
+	responseLimit := int64(intFromEnv("SCW_RESPONSE_MAX_SIZE", responseMaxSize))
+	if responseLimit <= 0 {
+		responseLimit = responseMaxSize
 	}
 
 	return func(response http.ResponseWriter, request *http.Request) {
+		// Health checks from the orchestrator are not function invocations
+		if health.serveHTTP(response, request) {
+			return
+		}
+		// Browsers send preflight requests without credentials, they never reach the function handler
+		if corsPolicy.ServePreflight(response, request) {
+			return
+		}
+
+		receivedAt := time.Now()
+		invocation := runtimeMetrics.startInvocation(response, request)
+		response = invocation.response
+		defer invocation.done()
+
+		// Identify the invocation in its event, context, logs and response
+		requestID := invocationID(request)
+		response.Header().Set(headerRequestID, requestID)
+		logger := logging.Default().With(logging.KeyInvocationID, requestID)
+
+		// Continue the trace of the caller, if any
+		ctx := request.Context()
+		if spanContext, ok := tracing.Extract(request.Header); ok {
+			ctx = tracing.ContextWithRemoteSpanContext(ctx, spanContext)
+		}
+		ctx, span := tracing.Start(ctx, "function invocation", tracing.SpanKindServer)
+		span.SetAttribute("http.method", request.Method)
+		span.SetAttribute("http.target", request.URL.Path)
+		span.SetAttribute("faas.trigger", invocation.trigger)
+		span.SetAttribute("faas.invocation_id", requestID)
+		defer func() {
+			span.SetAttribute("http.status_code", invocation.response.status)
+			if invocation.response.status >= http.StatusInternalServerError {
+				span.Status = tracing.StatusError
+			}
+			span.End()
+		}()
+
 		// Allow CORS
-		response.Header().Set("Access-Control-Allow-Origin", "*")
-		response.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		corsPolicy.SetHeaders(response, request)
 
 		// Access log
-		log.Print("Function Triggered")
+		logger.Log(logging.LevelInfo, "Function Triggered", logging.Fields{"method": request.Method, "path": request.URL.Path})
 		// 1: Authenticate
 		// Authenticate function, if an error occurs, do not execute the handler
-		if err := authentication.Authenticate(response, request); err != nil {
-			log.Print(err)
-			return
-		}
-
-		// 2: check payload size
-		defaultPayloadMaxSizeEnv := os.Getenv("SCW_PAYLOAD_MAX_SIZE")
-		defaultPayloadMaxSize, err := strconv.ParseInt(defaultPayloadMaxSizeEnv, 10, 64)
+		_, authSpan := tracing.Start(ctx, "authenticate", tracing.SpanKindInternal)
+		claims, err := authentication.AuthenticateClaims(response, request)
+		authSpan.SetError(err)
+		authSpan.End()
 		if err != nil {
-			defaultPayloadMaxSize = int64(payloadMaxSize)
+			logger.Warnf("Authentication failed: %v", err)
+			runtimeMetrics.authFailures.Inc(authentication.FailureReason(err))
+			return
 		}
 
-		if request.ContentLength > defaultPayloadMaxSize {
-			http.Error(response, ErrorPayloadTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		// 2: check payload size, announced sizes are rejected at once, others are checked while the body is read
+		if request.ContentLength > payloadLimit {
+			writePayloadTooLarge(response, payloadLimit)
 			return
 		}
+		body := newLimitedBody(request.Body, payloadLimit, ErrorPayloadTooLarge)
+		request.Body = body
 
 		// 3: Check event publisher
 		triggerType, err := events.GetTriggerType(request.Header.Get(headerTriggerType))
@@ -129,30 +353,99 @@ func buildRequestHandler() (func(http.ResponseWriter, *http.Request), error) {
 		}
 
 		// 4: Format event and context
-		event, err := events.FormatEvent(request, triggerType)
-		if err != nil {
+		_, formatSpan := tracing.Start(ctx, "format event", tracing.SpanKindInternal)
+		metadata := events.RequestMetadata{
+			RequestID:        requestID,
+			StreamBody:       fnInvoker.StreamRequestBody,
+			HeaderCase:       headerCase,
+			EventFormat:      eventFormat,
+			CloudEvents:      cloudEvents,
+			TextContentTypes: textContentTypes,
+			ReceivedAt:       receivedAt,
+			SourceIP:         proxies.sourceIP(request),
+			Claims:           claims.Map(),
+			Stage:            stage,
+			APIID:            applicationID,
+			AccountID:        namespaceID,
+		}
+		event, err := events.FormatEvent(request, triggerType, metadata)
+		formatSpan.SetError(err)
+		formatSpan.End()
+		if body.limitExceeded() {
+			writePayloadTooLarge(response, payloadLimit)
+			return
+		} else if errors.Is(err, events.ErrorInvalidCloudEvent) || errors.Is(err, events.ErrorInvalidCronEvent) {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
 			http.Error(response, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		context := events.GetExecutionContext()
+		ctx, cancel := context.WithTimeout(ctx, functionTimeout)
+		defer cancel()
+		deadline, _ := ctx.Deadline()
+		executionContext := events.GetExecutionContext().WithDeadline(deadline).WithInvocationID(requestID)
 
-		// 5: Execute Handler Based on runtime
-		handlerResponse, err := fnInvoker.Execute(event, context)
+		// 5: Execute Handler Based on runtime, the handler starts once the invocation left the queue
+		invocation.startQueue()
+		ctx = handler.ContextWithDispatched(ctx, invocation.startHandler)
+		var handlerResponse io.ReadCloser
+		if events.BodyStreamed(request, triggerType, metadata) {
+			// Streamed bodies are only checked against the payload limit while they are sent, they are not read anymore
+			// once an error is returned or the response is closed, which is always done before this handler returns
+			handlerResponse, err = fnInvoker.ExecuteStream(ctx, event, body, executionContext)
+			if err != nil && body.limitExceeded() {
+				invocation.endHandler()
+				writePayloadTooLarge(response, payloadLimit)
+				return
+			}
+		} else {
+			handlerResponse, err = fnInvoker.Execute(ctx, event, executionContext)
+		}
 		if err != nil {
-			http.Error(response, err.Error(), http.StatusInternalServerError)
+			invocation.endHandler()
+			if triggerType == events.TriggerTypeCron {
+				writeCronError(response, err)
+			} else {
+				writeExecutionError(response, err)
+			}
 			return
 		}
 		defer handlerResponse.Close()
 
+		// The scheduler of cron triggers is told whether the handler succeeded, and what it returned
+		if triggerType == events.TriggerTypeCron {
+			writeCronResult(ctx, response, newLimitedBody(handlerResponse, responseLimit, ErrorResponseTooLarge))
+			invocation.endHandler()
+			return
+		}
+
 		// Do not try to format HTTP response if trigger is NOT of type HTTP (would be pointless as nobody is waiting for the response)
 		if triggerType != events.TriggerTypeHTTP {
+			invocation.endHandler()
 			io.WriteString(response, "executed properly") // for a trigger 201 Created might be better, so we default to 200
 			return
 		}
 
+		// Streamed responses are sent as they are read, once their status code and headers are
+		if streamed, ok := handlerResponse.(*handler.StreamedResponse); ok {
+			streamed.ReadCloser = newLimitedBody(streamed.ReadCloser, responseLimit, ErrorResponseTooLarge)
+			writeStreamedResponse(ctx, response, streamed, logger)
+			invocation.endHandler()
+			return
+		}
+
 		// 6: Get statusCode, response body, and headers
-		handlerRes, err := handler.GetResponse(handlerResponse)
-		if err != nil {
+		limitedResponse := newLimitedBody(handlerResponse, responseLimit, ErrorResponseTooLarge)
+		handlerRes, err := handler.GetResponseFormat(limitedResponse, eventFormat)
+		invocation.endHandler()
+		if limitedResponse.limitExceeded() {
+			writeResponseTooLarge(response, responseLimit)
+			return
+		} else if ctx.Err() == context.DeadlineExceeded {
+			http.Error(response, handler.ErrorExecutionTimeout.Error(), http.StatusGatewayTimeout)
+			return
+		} else if err != nil {
 			http.Error(response, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -162,6 +455,9 @@ func buildRequestHandler() (func(http.ResponseWriter, *http.Request), error) {
 		for key, value := range handlerRes.Headers {
 			response.Header().Set(key, value)
 		}
+		for _, cookie := range handlerRes.Cookies {
+			response.Header().Add("Set-Cookie", cookie)
+		}
 
 		responseBody := handlerRes.Body
 		// If user's handler specifies the parameter isBase64Encoded, we need to transform base64 response to byte array
@@ -183,7 +479,46 @@ func buildRequestHandler() (func(http.ResponseWriter, *http.Request), error) {
 
 		response.WriteHeader(*handlerRes.StatusCode)
 		passHandlerResponse(response, responseBody)
-	}, nil
+	}
+}
+
+// writeStreamedResponse - send the status code and headers of a streamed response, then flush its body to the client
+// as it is read, until the handler completes, the client disconnects or the function times out
+func writeStreamedResponse(ctx context.Context, w http.ResponseWriter, streamed *handler.StreamedResponse, logger *logging.Logger) {
+	for key, value := range streamed.Headers {
+		w.Header().Set(key, value)
+	}
+	w.WriteHeader(streamed.StatusCode)
+
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	buffer := make([]byte, streamBufferSize)
+	for {
+		n, err := streamed.Read(buffer)
+		if n > 0 {
+			if _, writeErr := w.Write(buffer[:n]); writeErr != nil {
+				// Client disconnected, closing the response aborts the request to the sub-runtime
+				logger.Warnf("Streamed response aborted: %v", writeErr)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			// Status code has already been sent, the response can only be interrupted
+			if ctx.Err() == context.DeadlineExceeded {
+				err = handler.ErrorExecutionTimeout
+			}
+			logger.Warnf("Streamed response interrupted: %v", err)
+			return
+		}
+	}
 }
 
 func passHandlerResponse(w http.ResponseWriter, body json.RawMessage) {
@@ -1,11 +1,21 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/scaleway/functions-runtime/events"
 	"github.com/scaleway/functions-runtime/handler"
+	"github.com/scaleway/functions-runtime/logging"
 )
 
 func Test_passHandlerResponse_string(t *testing.T) {
@@ -77,3 +87,199 @@ func Test_passHandlerResponse_string_json(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func Test_passHandlerResponse_v2_simplified_string(t *testing.T) {
+	// Strings returned in the simplified form are sent as they are, without their quotes
+	r, err := handler.GetResponseFormat(strings.NewReader(`"hello"`), events.EventFormatV2)
+	if err != nil {
+		t.Fatalf("GetResponseFormat(), received error %v", err)
+	}
+	recorder := httptest.NewRecorder()
+	for key, value := range r.Headers {
+		recorder.Header().Set(key, value)
+	}
+	passHandlerResponse(recorder, r.Body)
+
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain") {
+		t.Errorf("Content-Type = %q, expected plain text", contentType)
+	}
+	if recorder.Body.String() != "hello" {
+		t.Errorf("body = %s, expected hello", recorder.Body)
+	}
+}
+
+func Test_writeStreamedResponse(t *testing.T) {
+	streamed := &handler.StreamedResponse{
+		ReadCloser: ioutil.NopCloser(strings.NewReader("data: 1\n\ndata: 2\n\n")),
+		StatusCode: http.StatusAccepted,
+		Headers:    map[string]string{"Content-Type": "text/event-stream"},
+	}
+	recorder := httptest.NewRecorder()
+	writeStreamedResponse(context.Background(), recorder, streamed, logging.Default())
+
+	if recorder.Code != http.StatusAccepted || recorder.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("streamed response sent with %d %v, expected %d", recorder.Code, recorder.Header(), http.StatusAccepted)
+	}
+	if !recorder.Flushed || recorder.Body.String() != "data: 1\n\ndata: 2\n\n" {
+		t.Errorf("streamed body %q (flushed %v), expected it to be flushed", recorder.Body.String(), recorder.Flushed)
+	}
+}
+
+// startTestInvoker - invoker whose sub-runtime only sleeps, invocations are sent to the given upstream server
+func startTestInvoker(t *testing.T, upstreamURL string) *handler.FunctionInvoker {
+	fnInvoker, err := handler.NewInvoker("sleep", "10", "", "handler", upstreamURL, false)
+	if err != nil {
+		t.Fatalf("NewInvoker(), received error %v", err)
+	}
+	if err := fnInvoker.Start(); err != nil {
+		t.Fatalf("Start(), received error %v", err)
+	}
+	if err := fnInvoker.WaitReady(context.Background()); err != nil {
+		t.Fatalf("WaitReady(), received error %v", err)
+	}
+	return fnInvoker
+}
+
+func Test_shutdown(t *testing.T) {
+	received := make(chan struct{})
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+		io.WriteString(w, `{"statusCode": 200, "body": "done"}`)
+	}))
+	defer upstream.Close()
+	defer func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}()
+
+	fnInvoker := startTestInvoker(t, upstream.URL)
+	s := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := fnInvoker.Execute(r.Context(), map[string]interface{}{}, events.GetExecutionContext())
+		if err != nil {
+			writeExecutionError(w, err)
+			return
+		}
+		defer res.Close()
+		io.Copy(w, res)
+	})}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(listener)
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		res, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			t.Errorf("in-flight invocation failed: %v", err)
+		}
+		responses <- res
+	}()
+	<-received
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- shutdown(s, fnInvoker)
+	}()
+
+	// Sub-runtime must keep running while the invocation is in-flight
+	select {
+	case <-fnInvoker.Done():
+		t.Fatal("sub-runtime stopped before the in-flight invocation completed")
+	case err := <-shutdownErr:
+		t.Fatalf("shutdown() returned %v before the in-flight invocation completed", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	if res := <-responses; res != nil {
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK || !strings.Contains(string(body), "done") {
+			t.Errorf("in-flight invocation answered %d %s, expected its response", res.StatusCode, body)
+		}
+	}
+	select {
+	case err := <-shutdownErr:
+		if err != nil {
+			t.Errorf("shutdown(), received error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown() did not complete in time")
+	}
+	if fnInvoker.Err() != handler.ErrorSubRuntimeStopped {
+		t.Errorf("Err() = %v, expected the sub-runtime to be stopped", fnInvoker.Err())
+	}
+}
+
+func TestStart_subRuntimeGivesUp(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, upstreamPort, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	bridge, err := ioutil.TempFile("", "scw-bridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(bridge.Name())
+	bridge.WriteString("exit 1")
+	bridge.Close()
+
+	env := map[string]string{
+		"PORT":                        "0",
+		"SCW_UPSTREAM_PORT":           upstreamPort,
+		"SCW_RUNTIME_BINARY":          "sh",
+		"SCW_RUNTIME_BRIDGE":          bridge.Name(),
+		"SCW_RUNTIME_RESTART_BACKOFF": "1ms",
+		"SCW_RUNTIME_MAX_CRASHES":     "1",
+	}
+	for name, value := range env {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- Start()
+	}()
+	select {
+	case err := <-errs:
+		if err == nil || !strings.Contains(err.Error(), "forked function has terminated") {
+			t.Errorf("Start() = %v, expected the error of the sub-runtime", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start() did not return once the sub-runtime gave up")
+	}
+}
+
+func Test_invocationTimeout(t *testing.T) {
+	// Handler never answers, the request is only aborted once the function times out
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	fnInvoker := startTestInvoker(t, upstream.URL)
+	defer fnInvoker.Stop(5 * time.Second)
+
+	recorder := httptest.NewRecorder()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	_, err := fnInvoker.Execute(ctx, map[string]interface{}{}, events.GetExecutionContext().WithDeadline(deadline))
+	writeExecutionError(recorder, err)
+
+	if recorder.Code != http.StatusGatewayTimeout || !strings.Contains(recorder.Body.String(), handler.ErrorExecutionTimeout.Error()) {
+		t.Errorf("hung handler answered %d %q, expected %d", recorder.Code, recorder.Body.String(), http.StatusGatewayTimeout)
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"os"
+	"strings"
+
+	"github.com/scaleway/functions-runtime/tracing"
+)
+
+const (
+	defaultServiceName  = "scaleway-function"
+	defaultOTLPEndpoint = "http://localhost:4318"
+	otlpTracesPath      = "/v1/traces"
+)
+
+// setUpTracing - configure the exporter of invocation traces from standard OpenTelemetry environment variables
+// OTEL_TRACES_EXPORTER selects the exporter: "otlp" (OTLP/HTTP with JSON encoding), "console" (stdout) or "none" (default)
+func setUpTracing() {
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = os.Getenv("SCW_APPLICATION_NAME")
+	}
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	switch os.Getenv("OTEL_TRACES_EXPORTER") {
+	case "otlp":
+		tracing.SetTracer(tracing.NewTracer(tracing.NewOTLPExporter(serviceName, otlpTracesEndpoint(), otlpHeaders())))
+	case "console", "stdout":
+		tracing.SetTracer(tracing.NewTracer(tracing.NewStdoutExporter(serviceName, os.Stdout)))
+	}
+}
+
+func otlpTracesEndpoint() string {
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	if endpoint == "" {
+		endpoint = defaultOTLPEndpoint
+	}
+	return strings.TrimSuffix(endpoint, "/") + otlpTracesPath
+}
+
+// otlpHeaders - headers sent to the collector, from a list of key=value pairs separated by commas
+func otlpHeaders() map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		keyValue := strings.SplitN(pair, "=", 2)
+		if len(keyValue) == 2 && strings.TrimSpace(keyValue[0]) != "" {
+			headers[strings.TrimSpace(keyValue[0])] = strings.TrimSpace(keyValue[1])
+		}
+	}
+	return headers
+}
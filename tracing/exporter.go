@@ -0,0 +1,290 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/scaleway/functions-runtime/logging"
+)
+
+const (
+	instrumentationScope = "github.com/scaleway/functions-runtime"
+	otlpBatchSize        = 512
+	otlpFlushInterval    = 5 * time.Second
+	otlpExportTimeout    = 10 * time.Second
+)
+
+// StdoutExporter - write spans as OTLP JSON lines, mostly useful for local testing
+type StdoutExporter struct {
+	serviceName string
+	mu          sync.Mutex
+	output      io.Writer
+}
+
+// NewStdoutExporter - create an exporter writing spans to the given output
+func NewStdoutExporter(serviceName string, output io.Writer) *StdoutExporter {
+	return &StdoutExporter{serviceName: serviceName, output: output}
+}
+
+// ExportSpan - write the span as a single JSON line
+func (e *StdoutExporter) ExportSpan(span *Span) {
+	line, err := json.Marshal(encodeSpans(e.serviceName, []*Span{span}))
+	if err != nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.output.Write(append(line, '\n'))
+}
+
+// Shutdown - nothing to flush, spans are written as soon as they end
+func (e *StdoutExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// OTLPExporter - send spans in batches to an OpenTelemetry collector with OTLP/HTTP and JSON encoding
+type OTLPExporter struct {
+	serviceName string
+	endpoint    string
+	headers     map[string]string
+	client      *http.Client
+
+	mu       sync.Mutex
+	batch    []*Span
+	flush    chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+// NewOTLPExporter - create an exporter sending spans to the given traces endpoint (e.g. http://localhost:4318/v1/traces)
+func NewOTLPExporter(serviceName, endpoint string, headers map[string]string) *OTLPExporter {
+	e := &OTLPExporter{
+		serviceName: serviceName,
+		endpoint:    endpoint,
+		headers:     headers,
+		client:      &http.Client{Timeout: otlpExportTimeout},
+		flush:       make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// ExportSpan - add the span to the current batch, sent when full or periodically
+func (e *OTLPExporter) ExportSpan(span *Span) {
+	e.mu.Lock()
+	e.batch = append(e.batch, span)
+	full := len(e.batch) >= otlpBatchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Shutdown - send remaining spans and stop the exporter
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+	})
+	select {
+	case <-e.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *OTLPExporter) run() {
+	defer close(e.stopped)
+
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.flush:
+		case <-e.stop:
+			e.send()
+			return
+		}
+		e.send()
+	}
+}
+
+func (e *OTLPExporter) send() {
+	e.mu.Lock()
+	batch := e.batch
+	e.batch = nil
+	e.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	if err := e.post(batch); err != nil {
+		logging.Warnf("Unable to export %d spans: %v", len(batch), err)
+	}
+}
+
+func (e *OTLPExporter) post(spans []*Span) error {
+	body, err := json.Marshal(encodeSpans(e.serviceName, spans))
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		request.Header.Set(key, value)
+	}
+
+	res, err := e.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("collector answered with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// ==== OTLP JSON encoding, see https://github.com/open-telemetry/opentelemetry-proto ==== //
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	TraceState        string          `json:"traceState,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func encodeSpans(serviceName string, spans []*Span) otlpTraces {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           span.Context.TraceID.String(),
+			SpanID:            span.Context.SpanID.String(),
+			TraceState:        span.Context.TraceState,
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+			Attributes:        encodeAttributes(span.Attributes),
+			Status:            otlpStatus{Code: span.Status, Message: span.StatusMessage},
+		}
+		if span.ParentSpanID.IsValid() {
+			s.ParentSpanID = span.ParentSpanID.String()
+		}
+		encoded = append(encoded, s)
+	}
+
+	return otlpTraces{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: encodeAttributes(map[string]interface{}{"service.name": serviceName}),
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: instrumentationScope},
+				Spans: encoded,
+			}},
+		}},
+	}
+}
+
+func encodeAttributes(attributes map[string]interface{}) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	encoded := make([]otlpAttribute, 0, len(attributes))
+	for _, key := range keys {
+		var v otlpAnyValue
+		switch typed := attributes[key].(type) {
+		case string:
+			v.StringValue = &typed
+		case bool:
+			v.BoolValue = &typed
+		case int:
+			i := strconv.Itoa(typed)
+			v.IntValue = &i
+		case int64:
+			i := strconv.FormatInt(typed, 10)
+			v.IntValue = &i
+		case float64:
+			v.DoubleValue = &typed
+		default:
+			s := fmt.Sprint(typed)
+			v.StringValue = &s
+		}
+		encoded = append(encoded, otlpAttribute{Key: key, Value: v})
+	}
+	return encoded
+}
@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// HeaderTraceParent - W3C Trace Context header carrying trace ID, parent span ID and trace flags
+	HeaderTraceParent = "traceparent"
+	// HeaderTraceState - W3C Trace Context header carrying vendor-specific trace information
+	HeaderTraceState = "tracestate"
+
+	flagSampled = 0x01
+)
+
+// TraceID - identifier of a trace
+type TraceID [16]byte
+
+// SpanID - identifier of a span within a trace
+type SpanID [8]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid - a trace ID made only of zeros is invalid
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid - a span ID made only of zeros is invalid
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// SpanContext - part of a span propagated across processes, as defined by W3C Trace Context
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+}
+
+// IsValid - whether the span context identifies a span
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// IsSampled - whether the trace is recorded
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&flagSampled != 0
+}
+
+// TraceParent - format the span context as a traceparent header value
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceParent - parse a traceparent header value, returns false if it is not valid
+func ParseTraceParent(value string) (SpanContext, bool) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	// Version 00 has exactly 4 fields, future versions may append fields
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+
+	if !decodeHex(parts[1], sc.TraceID[:]) || !decodeHex(parts[2], sc.SpanID[:]) {
+		return sc, false
+	}
+	var flags [1]byte
+	if !decodeHex(parts[3], flags[:]) {
+		return sc, false
+	}
+	sc.Flags = flags[0]
+
+	return sc, sc.IsValid()
+}
+
+func decodeHex(value string, dst []byte) bool {
+	if len(value) != hex.EncodedLen(len(dst)) || strings.ToLower(value) != value {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(value))
+	return err == nil
+}
+
+// Extract - read the span context propagated in the given headers, returns false if there is none
+func Extract(header http.Header) (SpanContext, bool) {
+	sc, ok := ParseTraceParent(header.Get(HeaderTraceParent))
+	if !ok {
+		return sc, false
+	}
+	sc.TraceState = header.Get(HeaderTraceState)
+	return sc, true
+}
+
+// Inject - propagate the given span context in headers
+func Inject(sc SpanContext, header http.Header) {
+	if !sc.IsValid() {
+		return
+	}
+	header.Set(HeaderTraceParent, sc.TraceParent())
+	if sc.TraceState != "" {
+		header.Set(HeaderTraceState, sc.TraceState)
+	}
+}
+
+// Carrier - propagate the given span context as a map, for protocols without headers
+func Carrier(sc SpanContext) map[string]string {
+	if !sc.IsValid() {
+		return nil
+	}
+	carrier := map[string]string{HeaderTraceParent: sc.TraceParent()}
+	if sc.TraceState != "" {
+		carrier[HeaderTraceState] = sc.TraceState
+	}
+	return carrier
+}
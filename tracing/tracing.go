@@ -0,0 +1,169 @@
+// Package tracing implements distributed tracing of invocations: W3C Trace Context propagation,
+// and spans exported with the OpenTelemetry protocol (OTLP) or to a stdout exporter for local testing
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// SpanKind - role of a span in a trace, values match OTLP ones
+type SpanKind int
+
+// Span kinds used by the core runtime
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Exporter - sends ended spans to a tracing backend
+type Exporter interface {
+	ExportSpan(span *Span)
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer - creates spans and sends them to its exporter once ended
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer - create a tracer exporting spans with the given exporter, spans are not recorded if exporter is nil
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+var (
+	defaultTracerMu sync.RWMutex
+	defaultTracer   = NewTracer(nil)
+)
+
+// SetTracer - set the tracer used by Start
+func SetTracer(tracer *Tracer) {
+	defaultTracerMu.Lock()
+	defer defaultTracerMu.Unlock()
+	defaultTracer = tracer
+}
+
+// Start - start a span with the tracer set with SetTracer, see Tracer.Start
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	defaultTracerMu.RLock()
+	tracer := defaultTracer
+	defaultTracerMu.RUnlock()
+	return tracer.Start(ctx, name, kind)
+}
+
+// Shutdown - flush spans of the tracer set with SetTracer, and stop its exporter
+func Shutdown(ctx context.Context) error {
+	defaultTracerMu.RLock()
+	tracer := defaultTracer
+	defaultTracerMu.RUnlock()
+	if tracer.exporter == nil {
+		return nil
+	}
+	return tracer.exporter.Shutdown(ctx)
+}
+
+type spanContextKey struct{}
+
+// ContextWithRemoteSpanContext - set a span context received from another process as parent of spans started from ctx
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext - span context of the current span of ctx, invalid if there is none
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// Start - start a span, child of the current span of ctx if any, the returned context holds the new span
+// The span must be ended with End to be exported
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+	// Spans are not recorded without exporter, the span context of the caller is propagated as it is
+	if t.exporter == nil {
+		return ctx, &Span{tracer: t, Name: name, Kind: kind, Context: parent}
+	}
+
+	span := &Span{
+		tracer:     t,
+		Name:       name,
+		Kind:       kind,
+		StartTime:  time.Now(),
+		Attributes: map[string]interface{}{},
+	}
+
+	if parent.IsValid() {
+		span.Context.TraceID = parent.TraceID
+		span.Context.Flags = parent.Flags
+		span.Context.TraceState = parent.TraceState
+		span.ParentSpanID = parent.SpanID
+	} else {
+		rand.Read(span.Context.TraceID[:])
+		span.Context.Flags = flagSampled
+	}
+	rand.Read(span.Context.SpanID[:])
+
+	return context.WithValue(ctx, spanContextKey{}, span.Context), span
+}
+
+// StatusCode - outcome of a span, values match OTLP ones
+type StatusCode int
+
+// Span status codes
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Span - a single operation within a trace
+type Span struct {
+	tracer *Tracer
+
+	Name          string
+	Kind          SpanKind
+	Context       SpanContext
+	ParentSpanID  SpanID
+	StartTime     time.Time
+	EndTime       time.Time
+	Attributes    map[string]interface{}
+	Status        StatusCode
+	StatusMessage string
+}
+
+// IsRecording - whether the span is exported once ended
+func (s *Span) IsRecording() bool {
+	return s.tracer.exporter != nil
+}
+
+// SetAttribute - set an attribute of the span, value must be a string, a bool, an integer or a float
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if !s.IsRecording() {
+		return
+	}
+	s.Attributes[key] = value
+}
+
+// SetError - mark the span as failed with the given error
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.Status = StatusError
+	s.StatusMessage = err.Error()
+}
+
+// End - end the span and export it if the trace is sampled
+func (s *Span) End() {
+	if !s.EndTime.IsZero() {
+		return
+	}
+	s.EndTime = time.Now()
+	if s.IsRecording() && s.Context.IsSampled() {
+		s.tracer.exporter.ExportSpan(s)
+	}
+}
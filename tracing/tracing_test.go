@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+type recordingExporter struct {
+	spans []*Span
+}
+
+func (e *recordingExporter) ExportSpan(span *Span) {
+	e.spans = append(e.spans, span)
+}
+
+func (e *recordingExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		valid   bool
+		sampled bool
+	}{
+		{"sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"not sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"future version with extra fields", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"empty", "", false, false},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"extra fields in version 00", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"zero trace ID", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"zero span ID", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01", false, false},
+		{"short trace ID", "00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sc, ok := ParseTraceParent(test.value)
+			if ok != test.valid {
+				t.Fatalf("ParseTraceParent(%q) valid = %v, expected %v", test.value, ok, test.valid)
+			}
+			if ok && sc.IsSampled() != test.sampled {
+				t.Errorf("IsSampled() = %v, expected %v", sc.IsSampled(), test.sampled)
+			}
+		})
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	header := http.Header{}
+	header.Set(HeaderTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	header.Set(HeaderTraceState, "vendor=value")
+
+	sc, ok := Extract(header)
+	if !ok {
+		t.Fatal("Extract(), expected valid span context")
+	}
+
+	injected := http.Header{}
+	Inject(sc, injected)
+	if injected.Get(HeaderTraceParent) != header.Get(HeaderTraceParent) || injected.Get(HeaderTraceState) != "vendor=value" {
+		t.Errorf("Inject(), got headers %v, expected %v", injected, header)
+	}
+}
+
+func TestTracerStart(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracer := NewTracer(exporter)
+
+	remote, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := ContextWithRemoteSpanContext(context.Background(), remote)
+
+	ctx, parent := tracer.Start(ctx, "parent", SpanKindServer)
+	_, child := tracer.Start(ctx, "child", SpanKindInternal)
+	child.End()
+	parent.End()
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("exported %d spans, expected 2", len(exporter.spans))
+	}
+	if parent.Context.TraceID != remote.TraceID || parent.ParentSpanID != remote.SpanID {
+		t.Errorf("parent span does not continue the remote trace")
+	}
+	if child.Context.TraceID != remote.TraceID || child.ParentSpanID != parent.Context.SpanID {
+		t.Errorf("child span is not a child of parent span")
+	}
+
+	t.Run("not sampled", func(t *testing.T) {
+		exporter := &recordingExporter{}
+		notSampled, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+		_, span := NewTracer(exporter).Start(ContextWithRemoteSpanContext(context.Background(), notSampled), "span", SpanKindServer)
+		span.End()
+		if len(exporter.spans) != 0 {
+			t.Errorf("exported %d spans, expected none", len(exporter.spans))
+		}
+	})
+}
+
+func TestTracerStart_noExporter(t *testing.T) {
+	tracer := NewTracer(nil)
+
+	t.Run("propagates the remote span context unchanged", func(t *testing.T) {
+		remote, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		ctx := ContextWithRemoteSpanContext(context.Background(), remote)
+		spanCtx, span := tracer.Start(ctx, "span", SpanKindServer)
+		span.SetAttribute("key", "value")
+		span.End()
+
+		if SpanContextFromContext(spanCtx) != remote || span.Context != remote {
+			t.Errorf("span context = %v, expected the remote one %v", span.Context, remote)
+		}
+	})
+
+	t.Run("starts no trace", func(t *testing.T) {
+		spanCtx, span := tracer.Start(context.Background(), "span", SpanKindServer)
+		if SpanContextFromContext(spanCtx).IsValid() || span.Context.IsValid() {
+			t.Errorf("span context = %v, expected none", span.Context)
+		}
+
+		header := http.Header{}
+		Inject(SpanContextFromContext(spanCtx), header)
+		if traceParent := header.Get(HeaderTraceParent); traceParent != "" {
+			t.Errorf("injected traceparent %q, expected none", traceParent)
+		}
+	})
+}